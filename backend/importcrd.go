@@ -0,0 +1,331 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+
+	"osdk-runner/generator"
+)
+
+// The subset of apiextensions.k8s.io/v1 CustomResourceDefinition that maps
+// onto OperatorData.
+
+type crdDocument struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec crdSpec `json:"spec"`
+}
+
+type crdSpec struct {
+	Group string `json:"group"`
+	Names struct {
+		Kind   string `json:"kind"`
+		Plural string `json:"plural"`
+	} `json:"names"`
+	Versions []crdVersion `json:"versions"`
+}
+
+type crdVersion struct {
+	Name    string `json:"name"`
+	Served  bool   `json:"served"`
+	Storage bool   `json:"storage"`
+	Schema  *struct {
+		OpenAPIV3Schema *jsonSchema `json:"openAPIV3Schema"`
+	} `json:"schema"`
+	Subresources *struct {
+		Status *struct{} `json:"status"`
+	} `json:"subresources"`
+}
+
+type jsonSchema struct {
+	Type                 string                `json:"type"`
+	Format               string                `json:"format"`
+	Properties           map[string]jsonSchema `json:"properties"`
+	Items                *jsonSchema           `json:"items"`
+	Required             []string              `json:"required"`
+	AdditionalProperties json.RawMessage       `json:"additionalProperties"`
+	Pattern              string                `json:"pattern"`
+	MinLength            *int64                `json:"minLength"`
+	MaxLength            *int64                `json:"maxLength"`
+	Minimum              *float64              `json:"minimum"`
+	Maximum              *float64              `json:"maximum"`
+	ExclusiveMinimum     bool                  `json:"exclusiveMinimum"`
+	ExclusiveMaximum     bool                  `json:"exclusiveMaximum"`
+	MultipleOf           *float64              `json:"multipleOf"`
+	MinItems             *int64                `json:"minItems"`
+	MaxItems             *int64                `json:"maxItems"`
+	UniqueItems          bool                  `json:"uniqueItems"`
+	MinProperties        *int64                `json:"minProperties"`
+	MaxProperties        *int64                `json:"maxProperties"`
+	Enum                 []json.RawMessage     `json:"enum"`
+	Default              json.RawMessage       `json:"default"`
+	Example              json.RawMessage       `json:"example"`
+	OneOf                json.RawMessage       `json:"oneOf"`
+	AnyOf                json.RawMessage       `json:"anyOf"`
+	AllOf                json.RawMessage       `json:"allOf"`
+	PreserveUnknown      bool                  `json:"x-kubernetes-preserve-unknown-fields"`
+	IntOrString          bool                  `json:"x-kubernetes-int-or-string"`
+}
+
+// CRDImport is the result of converting CustomResourceDefinition manifests.
+type CRDImport struct {
+	Domain   string              `json:"domain"`
+	CRDs     []CRD               `json:"crds"`
+	Warnings []generator.Warning `json:"warnings,omitempty"`
+}
+
+// ImportCRDs converts the CustomResourceDefinition documents read from r,
+// YAML or JSON separated by "---", into OperatorData CRDs with one entry per
+// served version. Groups are split into group and domain at domain, or at
+// their first dot when domain is empty. Schema features OperatorData cannot
+// express are reported as warnings.
+func ImportCRDs(r io.Reader, domain string) (*CRDImport, error) {
+	result := &CRDImport{Domain: domain, CRDs: []CRD{}}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(r, 4096)
+	for i := 0; ; i++ {
+		var doc crdDocument
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if doc.Kind == "" && doc.APIVersion == "" {
+			// empty document
+			continue
+		}
+		if doc.Kind != "CustomResourceDefinition" || doc.APIVersion != "apiextensions.k8s.io/v1" {
+			result.warn("", "", fmt.Sprintf("document %d (%s %s %s) is not an apiextensions.k8s.io/v1 CustomResourceDefinition and was skipped", i, doc.APIVersion, doc.Kind, doc.Metadata.Name))
+			continue
+		}
+		result.addCRD(doc)
+	}
+	if len(result.CRDs) == 0 {
+		return nil, errors.New("no apiextensions.k8s.io/v1 CustomResourceDefinition found")
+	}
+	return result, nil
+}
+
+func (r *CRDImport) warn(crd, field, message string) {
+	r.Warnings = append(r.Warnings, generator.Warning{CRD: crd, Field: field, Message: message})
+}
+
+// splitGroup splits a full API group into the OperatorData group and domain.
+func (r *CRDImport) splitGroup(fullGroup string) (string, bool) {
+	if r.Domain == "" {
+		group, domain, found := strings.Cut(fullGroup, ".")
+		if !found {
+			return "", false
+		}
+		r.Domain = domain
+		return group, true
+	}
+	group, found := strings.CutSuffix(fullGroup, "."+r.Domain)
+	return group, found && group != ""
+}
+
+func (r *CRDImport) addCRD(doc crdDocument) {
+	name := doc.Spec.Names.Kind
+	group, ok := r.splitGroup(doc.Spec.Group)
+	if !ok {
+		r.warn(name, "spec.group", fmt.Sprintf("group %q is not below the domain %q and was skipped", doc.Spec.Group, r.Domain))
+		return
+	}
+
+	var versions []CRD
+	var storage []bool
+	for _, version := range doc.Spec.Versions {
+		if !version.Served {
+			r.warn(name, "spec.versions."+version.Name, "version is not served and was skipped")
+			continue
+		}
+		crd := CRD{
+			Group:      group,
+			Version:    version.Name,
+			Kind:       doc.Spec.Names.Kind,
+			Plural:     doc.Spec.Names.Plural,
+			Controller: true,
+			Status:     version.Subresources != nil && version.Subresources.Status != nil,
+			RBAC:       []RBACPermission{},
+			Properties: []Property{},
+			Webhooks:   []WebhookConfig{},
+		}
+		if version.Schema != nil && version.Schema.OpenAPIV3Schema != nil {
+			root := version.Schema.OpenAPIV3Schema
+			prefix := "spec.versions." + version.Name + ".schema.openAPIV3Schema.properties"
+			if spec, ok := root.Properties["spec"]; ok {
+				crd.Properties = r.properties(name, prefix+".spec", spec)
+			}
+			if status, ok := root.Properties["status"]; ok {
+				crd.StatusConditions = hasConditions(status)
+				if crd.StatusConditions {
+					// these are generated by statusConditions
+					delete(status.Properties, "conditions")
+					delete(status.Properties, "observedGeneration")
+				}
+				crd.StatusProperties = r.properties(name, prefix+".status", status)
+			}
+		}
+		versions = append(versions, crd)
+		storage = append(storage, version.Storage)
+	}
+	if len(versions) < 2 {
+		r.CRDs = append(r.CRDs, versions...)
+		return
+	}
+
+	// a Kind served in several versions becomes one CRD with a versions list,
+	// taking the rest of its settings from the storage version
+	merged := versions[0]
+	for i, crd := range versions {
+		if storage[i] {
+			merged = crd
+		}
+	}
+	merged.Version = ""
+	for i, crd := range versions {
+		merged.Status = merged.Status || crd.Status
+		merged.Versions = append(merged.Versions, CRDVersion{
+			Name:             crd.Version,
+			Storage:          storage[i],
+			Properties:       crd.Properties,
+			StatusProperties: crd.StatusProperties,
+		})
+	}
+	r.CRDs = append(r.CRDs, merged)
+}
+
+// hasConditions reports whether a status schema has the standard conditions list.
+func hasConditions(status jsonSchema) bool {
+	conditions, ok := status.Properties["conditions"]
+	return ok && conditions.Type == "array" && conditions.Items != nil && conditions.Items.Type == "object"
+}
+
+// properties converts the properties of an object schema, sorted by name.
+func (r *CRDImport) properties(crd, path string, schema jsonSchema) []Property {
+	names := make([]string, 0, len(schema.Properties))
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	required := map[string]bool{}
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+
+	props := []Property{}
+	for _, name := range names {
+		prop := r.property(crd, path+"."+name, name, schema.Properties[name])
+		if required[name] {
+			prop.Validations = append(prop.Validations, Validation{Type: "required"})
+		}
+		props = append(props, prop)
+	}
+	return props
+}
+
+// property converts one schema into a Property and its validations.
+func (r *CRDImport) property(crd, path, name string, schema jsonSchema) Property {
+	prop := Property{Name: name, Type: schema.Type, Validations: []Validation{}}
+	add := func(validationType string, value interface{}) {
+		prop.Validations = append(prop.Validations, Validation{Type: validationType, Value: value})
+	}
+
+	if schema.IntOrString {
+		prop.Type = "string"
+		r.warn(crd, path, "x-kubernetes-int-or-string is not supported, the property is imported as a string")
+	}
+	if schema.PreserveUnknown {
+		r.warn(crd, path, "x-kubernetes-preserve-unknown-fields is not supported and was ignored")
+	}
+	for _, keyword := range []struct {
+		name string
+		raw  json.RawMessage
+	}{{"oneOf", schema.OneOf}, {"anyOf", schema.AnyOf}, {"allOf", schema.AllOf}} {
+		if len(keyword.raw) > 0 {
+			r.warn(crd, path, keyword.name+" is not supported and was ignored")
+		}
+	}
+
+	if schema.Format != "" {
+		add("format", schema.Format)
+	}
+	if schema.Pattern != "" {
+		add("pattern", schema.Pattern)
+	}
+	addInt := func(validationType string, value *int64) {
+		if value != nil {
+			add(validationType, strconv.FormatInt(*value, 10))
+		}
+	}
+	addFloat := func(validationType string, value *float64) {
+		if value != nil {
+			add(validationType, strconv.FormatFloat(*value, 'f', -1, 64))
+		}
+	}
+	addInt("minLength", schema.MinLength)
+	addInt("maxLength", schema.MaxLength)
+	addFloat("minimum", schema.Minimum)
+	addFloat("maximum", schema.Maximum)
+	if schema.ExclusiveMinimum {
+		add("exclusiveMinimum", true)
+	}
+	if schema.ExclusiveMaximum {
+		add("exclusiveMaximum", true)
+	}
+	addFloat("multipleOf", schema.MultipleOf)
+	addInt("minItems", schema.MinItems)
+	addInt("maxItems", schema.MaxItems)
+	if schema.UniqueItems {
+		add("uniqueItems", true)
+	}
+	addInt("minProperties", schema.MinProperties)
+	addInt("maxProperties", schema.MaxProperties)
+	if len(schema.Enum) > 0 {
+		values := []interface{}{}
+		for _, raw := range schema.Enum {
+			values = append(values, enumLiteral(raw))
+		}
+		add("enum", values)
+	}
+	if len(schema.Default) > 0 {
+		add("default", string(schema.Default))
+	}
+	if len(schema.Example) > 0 {
+		add("example", string(schema.Example))
+	}
+
+	switch schema.Type {
+	case "object":
+		if len(schema.Properties) > 0 {
+			prop.Properties = r.properties(crd, path, schema)
+		}
+	case "array":
+		if schema.Items != nil {
+			items := r.property(crd, path+".items", "", *schema.Items)
+			prop.Items = &items
+		}
+	}
+	return prop
+}
+
+// enumLiteral returns an enum value as the string written into the Enum
+// marker: strings unquoted, anything else as JSON.
+func enumLiteral(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"osdk-runner/generator"
+)
+
+// maxProjectArchiveSize bounds the size of uploaded project archives.
+const maxProjectArchiveSize = 64 << 20
+
+// uploadedArchive reads the zip archive of a request, sent either as the
+// field of a multipart form or as the raw request body.
+func uploadedArchive(c *gin.Context, field string) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxProjectArchiveSize)
+
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		file, _, err := c.Request.FormFile(field)
+		if err != nil {
+			return nil, fmt.Errorf("read uploaded %s: %w", field, err)
+		}
+		defer file.Close()
+		body = file
+	}
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("read archive: %w", err)
+	}
+	if _, err := openArchive(content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+func openArchive(content []byte) (*zip.Reader, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("read archive: %w", err)
+	}
+	return archive, nil
+}
+
+// extractProject extracts a project archive into a new temporary directory,
+// which the caller removes.
+func extractProject(content []byte) (string, error) {
+	archive, err := openArchive(content)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "osdk-import-")
+	if err != nil {
+		return "", err
+	}
+	if err := generator.ExtractProject(archive, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("extract archive: %w", err)
+	}
+	return dir, nil
+}
+
+// ImportProjectArchive rebuilds the OperatorData of the operator-sdk project
+// in the zip archive content so that it can be edited and generated again.
+func ImportProjectArchive(content []byte) (*generator.ProjectImport, error) {
+	dir, err := extractProject(content)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	imported, err := generator.ImportProject(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(imported.OperatorData.CRDs) == 0 {
+		return nil, errors.New("the project has no APIs")
+	}
+	return imported, nil
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"osdk-runner/generator"
+)
+
+// JobPhase is the lifecycle state of a generation job.
+type JobPhase string
+
+const (
+	JobPending     JobPhase = "pending"
+	JobScaffolding JobPhase = "scaffolding"
+	JobPatching    JobPhase = "patching"
+	JobZipping     JobPhase = "zipping"
+	JobDone        JobPhase = "done"
+	JobFailed      JobPhase = "failed"
+)
+
+// Job is an asynchronous generation request.
+type Job struct {
+	ID        string            `json:"id"`
+	Phase     JobPhase          `json:"phase"`
+	Error     string            `json:"error,omitempty"`
+	Failure   *generator.Error  `json:"failure,omitempty"`
+	Report    *generator.Result `json:"report,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+
+	projectName string
+	artifact    string
+	// readers counts the downloads of artifact in progress, which Cleanup
+	// waits for before deleting it.
+	readers int
+	// events records the steps of the generation for the logs endpoint.
+	events *generator.EventLog
+}
+
+// finished reports whether the job reached a terminal phase.
+func (j *Job) finished() bool {
+	return j.Phase == JobDone || j.Phase == JobFailed
+}
+
+// JobStore keeps generation jobs in memory and removes finished jobs, together
+// with their artifacts, once they are older than ttl.
+type JobStore struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+	ttl  time.Duration
+}
+
+func NewJobStore(ttl time.Duration) *JobStore {
+	return &JobStore{jobs: make(map[string]*Job), ttl: ttl}
+}
+
+// Submit registers a job for data and starts generating it in the background.
+func (s *JobStore) Submit(data OperatorData) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+	now := time.Now()
+	job := &Job{ID: id, Phase: JobPending, CreatedAt: now, UpdatedAt: now, projectName: data.ProjectName, events: generator.NewEventLog()}
+
+	s.mu.Lock()
+	s.jobs[id] = job
+	snapshot := *job
+	s.mu.Unlock()
+
+	go s.run(job, data)
+	return snapshot, nil
+}
+
+// Get returns a copy of the job with the given id.
+func (s *JobStore) Get(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Artifact returns the zip archive generated by the done job with the given id.
+func (s *JobStore) Artifact(id string) ([]byte, error) {
+	job, release, ok := s.Acquire(id)
+	if !ok {
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+	defer release()
+	if job.Phase != JobDone {
+		return nil, fmt.Errorf("job %s is not done", id)
+	}
+	return os.ReadFile(job.artifact)
+}
+
+// Acquire returns a copy of the job with the given id like Get and keeps its
+// artifact from being deleted by Cleanup until release is called.
+func (s *JobStore) Acquire(id string) (job Job, release func(), ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return Job{}, nil, false
+	}
+	j.readers++
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			j.readers--
+		})
+	}
+	return *j, release, true
+}
+
+// run generates the project of job. It is not tied to the submitting
+// request, so it keeps going after the client disconnects.
+func (s *JobStore) run(job *Job, data OperatorData) {
+	log.Printf("Job %s started for project %s", job.ID, data.ProjectName)
+	defer job.events.Close()
+	result, report, err := RunOperatorSDK(context.Background(), data, nil, generator.Generator{
+		OnPhase: func(p generator.Phase) {
+			s.update(job, func() { job.Phase = JobPhase(p) })
+		},
+		OnEvent: job.events.Add,
+	})
+	var artifact string
+	if err == nil {
+		s.update(job, func() { job.Phase = JobZipping })
+		name := data.ProjectName
+		if name == "" {
+			name = "operator-sdk-project"
+		}
+		artifact, err = zipArtifact(result, name)
+	}
+	if err != nil {
+		log.Printf("Job %s failed: %v", job.ID, err)
+		s.update(job, func() {
+			job.Phase = JobFailed
+			job.Error = err.Error()
+			errors.As(err, &job.Failure)
+		})
+		return
+	}
+	log.Printf("Job %s done: %s", job.ID, artifact)
+	s.update(job, func() {
+		job.Phase = JobDone
+		job.Report = report
+		job.artifact = artifact
+	})
+}
+
+func (s *JobStore) update(job *Job, fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+	job.UpdatedAt = time.Now()
+}
+
+// Cleanup removes finished jobs that have not changed for longer than the
+// store's ttl and deletes their artifacts.
+func (s *JobStore) Cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, job := range s.jobs {
+		if !job.finished() || time.Since(job.UpdatedAt) < s.ttl {
+			continue
+		}
+		if job.readers > 0 {
+			// still being downloaded, try again on the next run
+			continue
+		}
+		if job.artifact != "" {
+			if err := os.Remove(job.artifact); err != nil && !os.IsNotExist(err) {
+				log.Printf("Failed to remove artifact of job %s: %v", id, err)
+			}
+		}
+		delete(s.jobs, id)
+		log.Printf("Job %s expired", id)
+	}
+}
+
+// CleanupLoop calls Cleanup every interval until ctx is done.
+func (s *JobStore) CleanupLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Cleanup()
+		}
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// registerJobRoutes adds the endpoints for submitting jobs, polling their
+// status and downloading their archives.
+func registerJobRoutes(r *gin.Engine, jobs *JobStore) {
+	r.POST("/api/v1/jobs", func(c *gin.Context) {
+		data, ok := bindOperatorData(c)
+		if !ok {
+			return
+		}
+		job, err := jobs.Submit(data)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("Location", "/api/v1/jobs/"+job.ID)
+		c.JSON(http.StatusAccepted, job)
+	})
+
+	r.GET("/api/v1/jobs/:id", func(c *gin.Context) {
+		job, ok := jobs.Get(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	})
+
+	r.GET("/api/v1/jobs/:id/logs", func(c *gin.Context) {
+		job, ok := jobs.Get(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		c.Status(http.StatusOK)
+		c.Writer.Flush()
+
+		err := job.events.Follow(c.Request.Context(), func(e generator.Event) error {
+			c.SSEvent("step", e)
+			c.Writer.Flush()
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		// the log is closed once the job finished, so this is its final state
+		job, _ = jobs.Get(job.ID)
+		c.SSEvent("end", job)
+		c.Writer.Flush()
+	})
+
+	r.GET("/api/v1/jobs/:id/artifact", func(c *gin.Context) {
+		job, release, ok := jobs.Acquire(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+			return
+		}
+		defer release()
+		if job.Phase != JobDone {
+			c.JSON(http.StatusConflict, gin.H{"error": "job is not done", "details": string(job.Phase)})
+			return
+		}
+		patch, ok := wantsPatch(c)
+		if !ok {
+			return
+		}
+		if patch {
+			base, err := patchBase(c, jobs, nil)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read base project", "details": err.Error()})
+				return
+			}
+			sendPatch(c, job.projectName, base, job.artifact, job.Report)
+			return
+		}
+		if encoded, err := job.Report.HeaderValue(); err == nil {
+			c.Header(generator.ResultHeader, encoded)
+		}
+		name := job.projectName
+		if name == "" {
+			name = "operator-sdk-project"
+		}
+		c.FileAttachment(job.artifact, name+".zip")
+	})
+}
@@ -1,59 +1,154 @@
 package main
 
 import (
-	"archive/zip"
+	"context"
+	"errors"
 	"flag"
-	"io"
-	"io/fs"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
+
+	"osdk-runner/generator"
 )
 
-func zipDir(srcDir string, w io.Writer) error {
-	zipWriter := zip.NewWriter(w)
-	defer zipWriter.Close()
-	return filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if d.IsDir() {
-			return nil
-		}
-		relPath, err := filepath.Rel(srcDir, path)
-		if err != nil {
-			return err
-		}
-		f, err := zipWriter.Create(relPath)
-		if err != nil {
-			return err
-		}
-		srcFile, err := os.Open(path)
-		if err != nil {
-			return err
+// zipArtifact returns the path of a zip archive for the result of
+// RunOperatorSDK, zipping and removing the project directory of a local run.
+// The caller owns the returned file.
+func zipArtifact(result, name string) (string, error) {
+	if strings.HasSuffix(result, ".zip") {
+		return result, nil
+	}
+
+	// Directory that needs to be zipped (local execution)
+	defer os.RemoveAll(result)
+	zipFile, err := os.CreateTemp("", name+"-*.zip")
+	if err != nil {
+		return "", fmt.Errorf("failed to create zip file: %w", err)
+	}
+	if err := generator.ZipDir(result, zipFile); err != nil {
+		zipFile.Close()
+		os.Remove(zipFile.Name())
+		return "", fmt.Errorf("failed to zip project: %w", err)
+	}
+	if err := zipFile.Close(); err != nil {
+		os.Remove(zipFile.Name())
+		return "", fmt.Errorf("failed to write zip file: %w", err)
+	}
+
+	if fileInfo, err := os.Stat(zipFile.Name()); err == nil {
+		log.Printf("Zip file created with size: %d bytes", fileInfo.Size())
+	}
+	return zipFile.Name(), nil
+}
+
+var validate = newValidator()
+
+// newValidator returns a validator that names fields by their JSON names, so
+// errors can be reported with the same paths as ValidateSemantics.
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
 		}
-		defer srcFile.Close()
-		_, err = io.Copy(f, srcFile)
-		return err
+		return name
 	})
+	return v
+}
+
+// bindOperatorData decodes and validates the OperatorData request body,
+// answering 400 Bad Request when it is invalid. Semantic problems are listed
+// in "errors" by field path.
+func bindOperatorData(c *gin.Context) (OperatorData, bool) {
+	var data OperatorData
+	if err := c.ShouldBindJSON(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return data, false
+	}
+	return data, checkOperatorData(c, data)
+}
+
+// checkOperatorData validates data like bindOperatorData and answers 400 Bad
+// Request if it is invalid.
+func checkOperatorData(c *gin.Context, data OperatorData) bool {
+	if err := validate.Struct(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if errs := ValidateSemantics(data); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid operator data", "errors": errs})
+		return false
+	}
+	return true
+}
+
+// respondError answers 500 Internal Server Error with err, or the status a
+// runner answered err with. A *generator.Error is passed through as is, so
+// clients see the failed step, CRD and command.
+func respondError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	var runnerErr *runnerError
+	if errors.As(err, &runnerErr) {
+		status = runnerErr.status
+	}
+	var genErr *generator.Error
+	if errors.As(err, &genErr) {
+		c.JSON(status, genErr)
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
 }
 
-var validate = validator.New()
+// sendArtifact answers with the zip archive of a generated project and the
+// generator's report in the generator.ResultHeader header.
+func sendArtifact(c *gin.Context, data OperatorData, result string, report *generator.Result) {
+	filename := data.ProjectName
+	if filename == "" {
+		filename = "operator-sdk-project"
+	}
+
+	zipFilePath, err := zipArtifact(result, filename)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer os.Remove(zipFilePath)
+
+	if encoded, err := report.HeaderValue(); err == nil {
+		c.Header(generator.ResultHeader, encoded)
+	}
+	c.FileAttachment(zipFilePath, filename+".zip")
+}
 
 var executionMode string
+var jobTTL time.Duration
+
+// localModCache and localOffline configure the module cache of local
+// execution mode, see generator.Generator.
+var localModCache string
+var localOffline bool
 
 func init() {
-	flag.StringVar(&executionMode, "execution-mode", "kubernetes", "Execution mode: 'local' or 'kubernetes'")
-	flag.Parse()
+	flag.StringVar(&executionMode, "execution-mode", "kubernetes", "Execution mode: 'local' (generates on this host) or 'kubernetes'")
+	flag.DurationVar(&jobTTL, "job-ttl", time.Hour, "How long finished generation jobs and their artifacts are kept")
+	flag.StringVar(&localModCache, "mod-cache", "", "Pre-seeded Go module cache for local execution mode")
+	flag.BoolVar(&localOffline, "offline", false, "Generate without network access in local execution mode (GOPROXY=off)")
 }
 
 func main() {
+	flag.Parse()
+	jobs := NewJobStore(jobTTL)
+	go jobs.CleanupLoop(context.Background(), time.Minute)
+
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
 
@@ -62,6 +157,7 @@ func main() {
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"POST", "GET", "OPTIONS", "PUT", "DELETE"},
 		AllowHeaders:     []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization"},
+		ExposeHeaders:    []string{"Content-Disposition", generator.ResultHeader},
 		AllowCredentials: true,
 	}))
 
@@ -70,70 +166,142 @@ func main() {
 	})
 
 	r.POST("/api/v1/generate", func(c *gin.Context) {
-		var data OperatorData
-		if err := c.ShouldBindJSON(&data); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		patch, ok := wantsPatch(c)
+		if !ok {
 			return
 		}
-		if err := validate.Struct(&data); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		var data OperatorData
+		if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			data, ok = formOperatorData(c)
+		} else {
+			data, ok = bindOperatorData(c)
+		}
+		if !ok {
 			return
 		}
+		var base []byte
+		if patch {
+			var err error
+			if base, err = patchBase(c, jobs, nil); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read base project", "details": err.Error()})
+				return
+			}
+		}
 		log.Printf("Received data: %+v\n", data)
-		result, err := RunOperatorSDK(data)
+		result, report, err := RunOperatorSDK(c.Request.Context(), data, nil, generator.Generator{})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			respondError(c, err)
 			return
 		}
-		filename := data.ProjectName
-		if filename == "" {
-			filename = "operator-sdk-project"
+		if patch {
+			defer os.RemoveAll(result)
+			sendPatch(c, data.ProjectName, base, result, report)
+			return
 		}
+		sendArtifact(c, data, result, report)
+	})
 
-		var zipFilePath string
-		var needsCleanup bool
-
-		if strings.HasSuffix(result, ".zip") {
-			zipFilePath = result
-			needsCleanup = false
-		} else {
-			// Directory that needs to be zipped (local execution)
-			zipFilePath = filepath.Join(os.TempDir(), filename+".zip")
-			zipFile, err := os.Create(zipFilePath)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create zip file: " + err.Error()})
+	r.POST("/api/v1/generate/incremental", func(c *gin.Context) {
+		patch, ok := wantsPatch(c)
+		if !ok {
+			return
+		}
+		if !strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expected a multipart form with the data and project fields"})
+			return
+		}
+		project, err := uploadedArchive(c, "project")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read project archive", "details": err.Error()})
+			return
+		}
+		data, ok := formOperatorData(c)
+		if !ok {
+			return
+		}
+		var base []byte
+		if patch {
+			// without another base, the patch applies to the uploaded project
+			if base, err = patchBase(c, jobs, project); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read base project", "details": err.Error()})
 				return
 			}
+		}
+		log.Printf("Received incremental data: %+v\n", data)
+		result, report, err := RunOperatorSDK(c.Request.Context(), data, project, generator.Generator{})
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		if patch {
+			defer os.RemoveAll(result)
+			sendPatch(c, data.ProjectName, base, result, report)
+			return
+		}
+		sendArtifact(c, data, result, report)
+	})
 
-			if err := zipDir(result, zipFile); err != nil {
-				zipFile.Close()
-				os.Remove(zipFilePath)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to zip project: " + err.Error()})
+	r.POST("/api/v1/validate", func(c *gin.Context) {
+		var data OperatorData
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		errs := []FieldError{}
+		if err := validate.Struct(&data); err != nil {
+			var fieldErrs validator.ValidationErrors
+			if !errors.As(err, &fieldErrs) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 				return
 			}
-			zipFile.Close()
-			needsCleanup = true
+			for _, fe := range fieldErrs {
+				// drop the root type from paths such as OperatorData.crds[0].kind
+				field := strings.TrimPrefix(fe.Namespace(), "OperatorData.")
+				errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("failed on the %q rule", fe.Tag())})
+			}
 		}
+		errs = append(errs, ValidateSemantics(data)...)
+		c.JSON(http.StatusOK, gin.H{"valid": len(errs) == 0, "errors": errs})
+	})
 
-		// Get file size for Content-Length header
-		fileInfo, err := os.Stat(zipFilePath)
+	r.POST("/api/v1/preview", func(c *gin.Context) {
+		data, ok := bindOperatorData(c)
+		if !ok {
+			return
+		}
+		preview, err := PreviewOperatorSDK(c.Request.Context(), data)
 		if err != nil {
-			if needsCleanup {
-				os.Remove(zipFilePath)
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get zip file info: " + err.Error()})
+			respondError(c, err)
 			return
 		}
-		fileSize := fileInfo.Size()
-		log.Printf("Zip file created with size: %d bytes", fileSize)
+		c.JSON(http.StatusOK, preview)
+	})
 
-		c.FileAttachment(zipFilePath, filename+".zip")
+	r.POST("/api/v1/import/crd", func(c *gin.Context) {
+		imported, err := ImportCRDs(c.Request.Body, c.Query("domain"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to import CRDs", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, imported)
+	})
 
-		if needsCleanup {
-			defer os.Remove(zipFilePath)
+	r.POST("/api/v1/import/project", func(c *gin.Context) {
+		archive, err := uploadedArchive(c, "file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read project archive", "details": err.Error()})
+			return
 		}
+		imported, err := ImportProjectArchive(archive)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "failed to import project", "details": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, imported)
 	})
 
+	registerJobRoutes(r, jobs)
+
 	log.Println("Starting Operator SDK Backend API server on :8080...")
 	r.Run(":8080")
 }
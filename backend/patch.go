@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"osdk-runner/generator"
+)
+
+// wantsPatch reads the format query parameter of the generate endpoints,
+// answering 400 Bad Request for unknown formats.
+func wantsPatch(c *gin.Context) (patch, ok bool) {
+	switch format := c.Query("format"); format {
+	case "", "zip":
+		return false, true
+	case "patch":
+		return true, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown format", "details": fmt.Sprintf("%q is neither zip nor patch", format)})
+		return false, false
+	}
+}
+
+// formOperatorData decodes and validates the OperatorData in the data field
+// of a multipart form like bindOperatorData.
+func formOperatorData(c *gin.Context) (OperatorData, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxProjectArchiveSize)
+	var data OperatorData
+	if err := json.Unmarshal([]byte(c.PostForm("data")), &data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid data field", "details": err.Error()})
+		return data, false
+	}
+	return data, checkOperatorData(c, data)
+}
+
+// patchBase returns the archive of the project a patch is made against: the
+// artifact of the job named by the base query parameter, the base field of a
+// multipart form or else fallback.
+func patchBase(c *gin.Context, jobs *JobStore, fallback []byte) ([]byte, error) {
+	if id := c.Query("base"); id != "" {
+		return jobs.Artifact(id)
+	}
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		if _, _, err := c.Request.FormFile("base"); err == nil {
+			return uploadedArchive(c, "base")
+		}
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, errors.New("format=patch needs a base project, either a job ID in the base query parameter or an archive in the base form field")
+}
+
+// sendPatch answers with a unified diff from the project archive base to the
+// result of RunOperatorSDK or a job's artifact, together with the generator's
+// report in the generator.ResultHeader header. Unlike sendArtifact it leaves
+// result to the caller.
+func sendPatch(c *gin.Context, name string, base []byte, result string, report *generator.Result) {
+	baseDir, err := extractProject(base)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read base project", "details": err.Error()})
+		return
+	}
+	defer os.RemoveAll(baseDir)
+
+	dir := result
+	if strings.HasSuffix(result, ".zip") {
+		content, err := os.ReadFile(result)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if dir, err = extractProject(content); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read generated project", "details": err.Error()})
+			return
+		}
+		defer os.RemoveAll(dir)
+	}
+
+	var patch bytes.Buffer
+	if err := generator.DiffDirs(&patch, baseDir, dir); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to diff projects", "details": err.Error()})
+		return
+	}
+	log.Printf("Patch created with size: %d bytes", patch.Len())
+
+	if name == "" {
+		name = "operator-sdk-project"
+	}
+	if encoded, err := report.HeaderValue(); err == nil {
+		c.Header(generator.ResultHeader, encoded)
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".patch"))
+	c.Data(http.StatusOK, "text/x-diff; charset=utf-8", patch.Bytes())
+}
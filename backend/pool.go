@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// runnerPoolWaitTimeout bounds how long a generation waits in the queue
+	// for a free runner.
+	runnerPoolWaitTimeout = 10 * time.Minute
+	// runnerLeaseAnnotation marks a pooled runner as busy with the lease
+	// "<holder> <expiry>" of the backend using it.
+	runnerLeaseAnnotation = "osdk-backend/runner-lease"
+	// runnerLeaseDuration is how long a lease lasts if its backend never
+	// releases it, as long as a runner Job may be active.
+	runnerLeaseDuration = time.Duration(runnerJobDeadline) * time.Second
+)
+
+// RunnerPool hands out the pods of a long-lived, pre-warmed runner
+// Deployment. Every pod serves one generation at a time, each in its own
+// workspace; generations wait in FIFO order until a pod is free.
+//
+// A runner is claimed by adding a lease annotation to its pod, conditional on
+// the pod's resourceVersion, so several backend replicas can share a pool.
+// The FIFO order only holds within one replica.
+type RunnerPool struct {
+	Client    kubernetes.Interface
+	Namespace string
+	// Selector is the label selector of the pool's pods.
+	Selector string
+	// Holder names this backend in the leases of the runners it uses.
+	Holder string
+	// WaitTimeout bounds how long a generation waits for a free runner.
+	WaitTimeout time.Duration
+
+	// queue holds a token for the generation at the head of the queue, the
+	// only one looking for a free runner.
+	queue chan struct{}
+}
+
+func NewRunnerPool(client kubernetes.Interface, namespace, selector, holder string) *RunnerPool {
+	return &RunnerPool{
+		Client:      client,
+		Namespace:   namespace,
+		Selector:    selector,
+		Holder:      holder,
+		WaitTimeout: runnerPoolWaitTimeout,
+		queue:       make(chan struct{}, 1),
+	}
+}
+
+// NewRunnerPoolFromEnv configures a RunnerPool for the in-cluster API server
+// using the pods matching selector in OPERATOR_SDK_RUNNER_NAMESPACE. Its
+// leases are held by OPERATOR_SDK_BACKEND_POD_NAME, or else the host name.
+func NewRunnerPoolFromEnv(selector string) (*RunnerPool, error) {
+	clientset, err := inClusterClient()
+	if err != nil {
+		return nil, err
+	}
+	holder := os.Getenv("OPERATOR_SDK_BACKEND_POD_NAME")
+	if holder == "" {
+		if holder, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("failed to name the runner lease holder: %w", err)
+		}
+	}
+	return NewRunnerPool(clientset, os.Getenv("OPERATOR_SDK_RUNNER_NAMESPACE"), selector, holder), nil
+}
+
+// WithRunner waits for a free runner of the pool and calls fn with its base
+// URL. The runner goes back to the pool afterwards.
+func (p *RunnerPool) WithRunner(ctx context.Context, data OperatorData, fn func(runnerURL string) error) error {
+	pod, err := p.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.release(pod.Name, pod.Annotations[runnerLeaseAnnotation])
+
+	log.Printf("Using pooled runner %s at %s for project %s", pod.Name, pod.Status.PodIP, data.ProjectName)
+	return fn(fmt.Sprintf("http://%s:%d", pod.Status.PodIP, runnerPort))
+}
+
+func (p *RunnerPool) acquire(ctx context.Context) (*v1.Pod, error) {
+	timeout := p.WaitTimeout
+	if timeout == 0 {
+		timeout = runnerPoolWaitTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	select {
+	case p.queue <- struct{}{}:
+		defer func() { <-p.queue }()
+	case <-ctx.Done():
+		return nil, p.waitError(ctx)
+	}
+
+	pods := p.Client.CoreV1().Pods(p.Namespace)
+	selector := metav1.ListOptions{LabelSelector: p.Selector}
+	for {
+		list, err := pods.List(ctx, selector)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, p.waitError(ctx)
+			}
+			return nil, fmt.Errorf("failed to list pooled runners: %w", err)
+		}
+		pod, err := p.claimFree(ctx, list.Items)
+		if pod != nil || err != nil {
+			if err != nil && ctx.Err() != nil {
+				return nil, p.waitError(ctx)
+			}
+			return pod, err
+		}
+
+		// Wait until one of the pool's pods changes, which includes a
+		// runner being released
+		watchOptions := selector
+		watchOptions.ResourceVersion = list.ResourceVersion
+		w, err := pods.Watch(ctx, watchOptions)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, p.waitError(ctx)
+			}
+			return nil, fmt.Errorf("failed to watch pooled runners: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			w.Stop()
+			return nil, p.waitError(ctx)
+		case <-w.ResultChan():
+		}
+		w.Stop()
+	}
+}
+
+// claimFree leases the first ready runner among pods that has no current
+// lease and returns it. Runners changed since they were listed, e.g. leased
+// by another backend, are left alone.
+func (p *RunnerPool) claimFree(ctx context.Context, pods []v1.Pod) (*v1.Pod, error) {
+	now := time.Now()
+	for i := range pods {
+		pod := pods[i].DeepCopy()
+		if ready, _ := runnerPodReady(pod); !ready || leased(pod, now) {
+			continue
+		}
+		if pod.Annotations == nil {
+			pod.Annotations = map[string]string{}
+		}
+		pod.Annotations[runnerLeaseAnnotation] = p.Holder + " " + now.Add(runnerLeaseDuration).UTC().Format(time.RFC3339)
+		claimed, err := p.Client.CoreV1().Pods(p.Namespace).Update(ctx, pod, metav1.UpdateOptions{})
+		if apierrors.IsConflict(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to lease pooled runner %s: %w", pod.Name, err)
+		}
+		return claimed, nil
+	}
+	return nil, nil
+}
+
+// leased reports whether pod holds a lease that has not expired at now.
+func leased(pod *v1.Pod, now time.Time) bool {
+	lease, ok := pod.Annotations[runnerLeaseAnnotation]
+	if !ok {
+		return false
+	}
+	_, expiry, _ := strings.Cut(lease, " ")
+	expires, err := time.Parse(time.RFC3339, expiry)
+	return err == nil && now.Before(expires)
+}
+
+// release removes lease from the pod podName unless another backend took the
+// runner over in the meantime. A lease that cannot be removed expires.
+func (p *RunnerPool) release(podName, lease string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	pods := p.Client.CoreV1().Pods(p.Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		pod, err := pods.Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if pod.Annotations[runnerLeaseAnnotation] != lease {
+			return nil
+		}
+		delete(pod.Annotations, runnerLeaseAnnotation)
+		_, err = pods.Update(ctx, pod, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Printf("Warning: failed to release pooled runner %s: %v", podName, err)
+	}
+}
+
+func (p *RunnerPool) waitError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out waiting for a free runner matching %s", p.Selector)
+	}
+	return ctx.Err()
+}
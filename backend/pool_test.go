@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func pooledRunner(name string) *v1.Pod {
+	pod := runnerPod(v1.PodRunning, true)
+	pod.Name = name
+	pod.Labels = map[string]string{"app": "osdk-runner-pool"}
+	return pod
+}
+
+func TestRunnerPoolLeasesAcrossBackends(t *testing.T) {
+	client := fake.NewClientset(pooledRunner("runner-a"))
+	first := NewRunnerPool(client, "osdk", "app=osdk-runner-pool", "backend-0")
+	second := NewRunnerPool(client, "osdk", "app=osdk-runner-pool", "backend-1")
+	second.WaitTimeout = 100 * time.Millisecond
+
+	err := first.WithRunner(context.Background(), OperatorData{}, func(string) error {
+		pod, err := client.CoreV1().Pods("osdk").Get(context.Background(), "runner-a", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get runner pod: %v", err)
+		}
+		if !leased(pod, time.Now()) {
+			t.Errorf("runner lease = %q, want a current lease", pod.Annotations[runnerLeaseAnnotation])
+		}
+		if err := second.WithRunner(context.Background(), OperatorData{}, func(string) error { return nil }); err == nil {
+			t.Error("second backend got the runner leased by the first")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithRunner: %v", err)
+	}
+
+	called := false
+	if err := second.WithRunner(context.Background(), OperatorData{}, func(string) error {
+		called = true
+		return nil
+	}); err != nil || !called {
+		t.Errorf("second backend did not get the released runner: %v", err)
+	}
+	pod, err := client.CoreV1().Pods("osdk").Get(context.Background(), "runner-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("get runner pod: %v", err)
+	}
+	if lease, ok := pod.Annotations[runnerLeaseAnnotation]; ok {
+		t.Errorf("runner lease = %q after release, want none", lease)
+	}
+}
+
+func TestRunnerPoolTakesOverExpiredLease(t *testing.T) {
+	pod := pooledRunner("runner-a")
+	pod.Annotations = map[string]string{runnerLeaseAnnotation: "crashed-backend " + time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)}
+	client := fake.NewClientset(pod)
+	pool := NewRunnerPool(client, "osdk", "app=osdk-runner-pool", "backend-0")
+	pool.WaitTimeout = time.Second
+
+	if err := pool.WithRunner(context.Background(), OperatorData{}, func(string) error { return nil }); err != nil {
+		t.Errorf("WithRunner: %v", err)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// runnerPort is the port the runner's HTTP server listens on.
+	runnerPort = 8080
+	// runnerReadyTimeout bounds how long a runner pod may take to become ready.
+	runnerReadyTimeout = 120 * time.Second
+	// runnerJobTTL is how long Kubernetes keeps a finished runner Job, in case
+	// the backend could not delete it itself.
+	runnerJobTTL int32 = 300
+	// runnerJobDeadline is the longest a runner Job may be active.
+	runnerJobDeadline int64 = 1800
+)
+
+// RunnerLauncher runs every generation in its own runner Job and makes sure
+// the Job and its pod are removed afterwards.
+type RunnerLauncher struct {
+	Client    kubernetes.Interface
+	Namespace string
+	// Name prefixes the names of the runner Jobs.
+	Name  string
+	Image string
+	// Owner, if set, is added as the owner of every runner Job so they are
+	// garbage collected together with the backend pod.
+	Owner *metav1.OwnerReference
+	// ReadyTimeout bounds how long a runner pod may take to become ready.
+	ReadyTimeout time.Duration
+}
+
+// NewRunnerLauncherFromEnv configures a RunnerLauncher for the in-cluster
+// API server from the OPERATOR_SDK_RUNNER_* env vars. The backend pod
+// becomes the owner of the runner Jobs when OPERATOR_SDK_BACKEND_POD_NAME and
+// OPERATOR_SDK_BACKEND_POD_UID are set.
+func NewRunnerLauncherFromEnv() (*RunnerLauncher, error) {
+	clientset, err := inClusterClient()
+	if err != nil {
+		return nil, err
+	}
+
+	launcher := &RunnerLauncher{
+		Client:       clientset,
+		Namespace:    os.Getenv("OPERATOR_SDK_RUNNER_NAMESPACE"),
+		Name:         os.Getenv("OPERATOR_SDK_RUNNER_NAME"),
+		Image:        os.Getenv("OPERATOR_SDK_RUNNER_IMAGE"),
+		ReadyTimeout: runnerReadyTimeout,
+	}
+	podName, podUID := os.Getenv("OPERATOR_SDK_BACKEND_POD_NAME"), os.Getenv("OPERATOR_SDK_BACKEND_POD_UID")
+	if podName != "" && podUID != "" {
+		launcher.Owner = &metav1.OwnerReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       podName,
+			UID:        types.UID(podUID),
+		}
+	}
+	return launcher, nil
+}
+
+func inClusterClient() (kubernetes.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get in-cluster config: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return clientset, nil
+}
+
+// runnerProvider hands out a runner for the duration of fn.
+type runnerProvider interface {
+	WithRunner(ctx context.Context, data OperatorData, fn func(runnerURL string) error) error
+}
+
+// defaultRunnerProvider is used in kubernetes execution mode: the warm runner
+// pool selected by OPERATOR_SDK_RUNNER_POOL if set, otherwise one runner Job
+// per generation.
+var defaultRunnerProvider = sync.OnceValues(func() (runnerProvider, error) {
+	if selector := os.Getenv("OPERATOR_SDK_RUNNER_POOL"); selector != "" {
+		return NewRunnerPoolFromEnv(selector)
+	}
+	return NewRunnerLauncherFromEnv()
+})
+
+// withRunner gets a runner for data from the default provider and calls fn
+// with the runner's base URL.
+func withRunner(ctx context.Context, data OperatorData, fn func(runnerURL string) error) error {
+	provider, err := defaultRunnerProvider()
+	if err != nil {
+		return err
+	}
+	return provider.WithRunner(ctx, data, fn)
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// jobNamePrefix returns a GenerateName prefix for the runner Job of data.
+func (l *RunnerLauncher) jobNamePrefix(data OperatorData) string {
+	prefix := l.Name
+	if project := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(data.ProjectName), "-"), "-"); project != "" {
+		prefix += "-" + project
+	}
+	// leave room for the generated suffix and the pod name suffix
+	if len(prefix) > 40 {
+		prefix = strings.TrimRight(prefix[:40], "-")
+	}
+	return prefix + "-"
+}
+
+func (l *RunnerLauncher) newJob(data OperatorData) *batchv1.Job {
+	backoffLimit := int32(0)
+	ttl := runnerJobTTL
+	deadline := runnerJobDeadline
+	labels := map[string]string{"app": l.Name}
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: l.jobNamePrefix(data),
+			Namespace:    l.Namespace,
+			Labels:       labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			TTLSecondsAfterFinished: &ttl,
+			ActiveDeadlineSeconds:   &deadline,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{
+							Name:  "runner",
+							Image: l.Image,
+							Ports: []v1.ContainerPort{{ContainerPort: runnerPort}},
+							ReadinessProbe: &v1.Probe{
+								ProbeHandler: v1.ProbeHandler{
+									TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt32(runnerPort)},
+								},
+								PeriodSeconds: 1,
+							},
+						},
+					},
+					RestartPolicy: v1.RestartPolicyNever,
+				},
+			},
+		},
+	}
+	if l.Owner != nil {
+		job.OwnerReferences = []metav1.OwnerReference{*l.Owner}
+	}
+	return job
+}
+
+// WithRunner creates a runner Job for data, waits until its pod is ready and
+// calls fn with the runner's base URL. The Job and its pod are deleted
+// afterwards, whatever the outcome.
+func (l *RunnerLauncher) WithRunner(ctx context.Context, data OperatorData, fn func(runnerURL string) error) error {
+	jobs := l.Client.BatchV1().Jobs(l.Namespace)
+	job, err := jobs.Create(ctx, l.newJob(data), metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create runner job: %w", err)
+	}
+	log.Printf("Created runner job %s", job.Name)
+
+	// Clean up the job and its pod, also when ctx is already cancelled
+	defer func() {
+		deleteCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		propagation := metav1.DeletePropagationBackground
+		err := jobs.Delete(deleteCtx, job.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil {
+			log.Printf("Warning: failed to delete runner job %s: %v", job.Name, err)
+		}
+	}()
+
+	pod, err := l.waitForRunnerPod(ctx, job.Name)
+	if err != nil {
+		return err
+	}
+	log.Printf("Runner pod %s is ready at %s", pod.Name, pod.Status.PodIP)
+	return fn(fmt.Sprintf("http://%s:%d", pod.Status.PodIP, runnerPort))
+}
+
+// waitForRunnerPod watches the pods of the runner Job jobName until one is
+// ready to serve, fails, or ReadyTimeout passes.
+func (l *RunnerLauncher) waitForRunnerPod(ctx context.Context, jobName string) (*v1.Pod, error) {
+	timeout := l.ReadyTimeout
+	if timeout == 0 {
+		timeout = runnerReadyTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pods := l.Client.CoreV1().Pods(l.Namespace)
+	selector := metav1.ListOptions{LabelSelector: batchv1.JobNameLabel + "=" + jobName}
+	for {
+		list, err := pods.List(ctx, selector)
+		if err != nil {
+			return nil, waitError(ctx, jobName, fmt.Errorf("failed to list runner pods: %w", err))
+		}
+		for i := range list.Items {
+			if ready, err := runnerPodReady(&list.Items[i]); ready || err != nil {
+				return &list.Items[i], err
+			}
+		}
+
+		watchOptions := selector
+		watchOptions.ResourceVersion = list.ResourceVersion
+		w, err := pods.Watch(ctx, watchOptions)
+		if err != nil {
+			return nil, waitError(ctx, jobName, fmt.Errorf("failed to watch runner pods: %w", err))
+		}
+		pod, err := waitForReadyEvent(ctx, w)
+		w.Stop()
+		if pod != nil || err != nil {
+			return pod, waitError(ctx, jobName, err)
+		}
+		// the watch expired, list again
+	}
+}
+
+// waitForReadyEvent reads w until a pod is ready or failed. It returns
+// nil, nil when the watch ends before that.
+func waitForReadyEvent(ctx context.Context, w watch.Interface) (*v1.Pod, error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return nil, nil
+			}
+			switch event.Type {
+			case watch.Error:
+				return nil, fmt.Errorf("watching runner pods failed: %v", event.Object)
+			case watch.Deleted:
+				continue
+			}
+			pod, ok := event.Object.(*v1.Pod)
+			if !ok {
+				continue
+			}
+			if ready, err := runnerPodReady(pod); ready || err != nil {
+				return pod, err
+			}
+		}
+	}
+}
+
+// waitError explains err, replacing the context error of a timeout.
+func waitError(ctx context.Context, jobName string, err error) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out waiting for runner job %s to be ready", jobName)
+	}
+	return err
+}
+
+// runnerPodReady reports whether pod can serve requests, or why it never will.
+func runnerPodReady(pod *v1.Pod) (bool, error) {
+	switch pod.Status.Phase {
+	case v1.PodFailed:
+		return false, fmt.Errorf("runner pod %s failed: %s", pod.Name, podFailureMessage(pod))
+	case v1.PodSucceeded:
+		return false, fmt.Errorf("runner pod %s exited before serving", pod.Name)
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if waiting := status.State.Waiting; waiting != nil {
+			switch waiting.Reason {
+			case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError":
+				return false, fmt.Errorf("runner pod %s cannot start: %s: %s", pod.Name, waiting.Reason, waiting.Message)
+			}
+		}
+	}
+	if pod.Status.Phase != v1.PodRunning || pod.Status.PodIP == "" {
+		return false, nil
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue, nil
+		}
+	}
+	return false, nil
+}
+
+func podFailureMessage(pod *v1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if terminated := status.State.Terminated; terminated != nil {
+			return fmt.Sprintf("%s (exit code %d) %s", terminated.Reason, terminated.ExitCode, terminated.Message)
+		}
+	}
+	if pod.Status.Message != "" {
+		return pod.Status.Message
+	}
+	return pod.Status.Reason
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testJobName = "runner-demo-x1y2z"
+
+// newTestLauncher returns a RunnerLauncher on a fake clientset whose pod
+// watches deliver podEvents. The fake clientset does not implement
+// GenerateName, so every runner Job is named testJobName.
+func newTestLauncher(podEvents ...*v1.Pod) (*RunnerLauncher, *fake.Clientset) {
+	client := fake.NewClientset()
+	client.PrependReactor("create", "jobs", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		job := action.(k8stesting.CreateAction).GetObject().(*batchv1.Job)
+		if job.Name == "" {
+			job.Name = testJobName
+		}
+		return false, nil, nil
+	})
+	client.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewRaceFreeFake()
+		for _, pod := range podEvents {
+			w.Modify(pod)
+		}
+		return true, w, nil
+	})
+
+	launcher := &RunnerLauncher{
+		Client:       client,
+		Namespace:    "osdk",
+		Name:         "runner",
+		Image:        "runner:test",
+		ReadyTimeout: 5 * time.Second,
+	}
+	return launcher, client
+}
+
+func runnerPod(phase v1.PodPhase, ready bool) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      testJobName + "-abcde",
+			Namespace: "osdk",
+			Labels:    map[string]string{batchv1.JobNameLabel: testJobName},
+		},
+		Status: v1.PodStatus{Phase: phase},
+	}
+	if phase == v1.PodRunning {
+		pod.Status.PodIP = "10.0.0.7"
+	}
+	if ready {
+		pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	}
+	return pod
+}
+
+// assertJobDeleted checks that WithRunner deleted the runner Job again.
+func assertJobDeleted(t *testing.T, client *fake.Clientset) {
+	t.Helper()
+	deleted := false
+	for _, action := range client.Actions() {
+		if action.Matches("delete", "jobs") && action.(k8stesting.DeleteAction).GetName() == testJobName {
+			deleted = true
+		}
+	}
+	if !deleted {
+		t.Errorf("runner job %s was not deleted", testJobName)
+	}
+	jobs, err := client.BatchV1().Jobs("osdk").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("list jobs: %v", err)
+	}
+	if len(jobs.Items) != 0 {
+		t.Errorf("got %d runner jobs left, want none", len(jobs.Items))
+	}
+}
+
+func TestNewJob(t *testing.T) {
+	launcher, _ := newTestLauncher()
+	launcher.Owner = &metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "backend-0", UID: types.UID("1234")}
+
+	job := launcher.newJob(OperatorData{ProjectName: "Demo Operator"})
+
+	if job.GenerateName != "runner-demo-operator-" {
+		t.Errorf("GenerateName = %q, want %q", job.GenerateName, "runner-demo-operator-")
+	}
+	if job.Namespace != "osdk" {
+		t.Errorf("Namespace = %q, want osdk", job.Namespace)
+	}
+	if limit := job.Spec.BackoffLimit; limit == nil || *limit != 0 {
+		t.Errorf("BackoffLimit = %v, want 0", limit)
+	}
+	if ttl := job.Spec.TTLSecondsAfterFinished; ttl == nil || *ttl != runnerJobTTL {
+		t.Errorf("TTLSecondsAfterFinished = %v, want %d", ttl, runnerJobTTL)
+	}
+	if deadline := job.Spec.ActiveDeadlineSeconds; deadline == nil || *deadline != runnerJobDeadline {
+		t.Errorf("ActiveDeadlineSeconds = %v, want %d", deadline, runnerJobDeadline)
+	}
+	if len(job.OwnerReferences) != 1 || job.OwnerReferences[0] != *launcher.Owner {
+		t.Errorf("OwnerReferences = %v, want [%v]", job.OwnerReferences, *launcher.Owner)
+	}
+	pod := job.Spec.Template.Spec
+	if pod.RestartPolicy != v1.RestartPolicyNever {
+		t.Errorf("RestartPolicy = %q, want Never", pod.RestartPolicy)
+	}
+	if len(pod.Containers) != 1 || pod.Containers[0].Image != "runner:test" {
+		t.Errorf("Containers = %v, want one runner:test container", pod.Containers)
+	}
+}
+
+func TestNewJobWithoutOwner(t *testing.T) {
+	launcher, _ := newTestLauncher()
+
+	job := launcher.newJob(OperatorData{})
+
+	if job.GenerateName != "runner-" {
+		t.Errorf("GenerateName = %q, want %q", job.GenerateName, "runner-")
+	}
+	if len(job.OwnerReferences) != 0 {
+		t.Errorf("OwnerReferences = %v, want none", job.OwnerReferences)
+	}
+}
+
+func TestWithRunnerWaitsForReadyPod(t *testing.T) {
+	launcher, client := newTestLauncher(
+		runnerPod(v1.PodPending, false),
+		runnerPod(v1.PodRunning, false),
+		runnerPod(v1.PodRunning, true),
+	)
+
+	var runnerURL string
+	err := launcher.WithRunner(context.Background(), OperatorData{ProjectName: "demo"}, func(url string) error {
+		runnerURL = url
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithRunner: %v", err)
+	}
+	if runnerURL != "http://10.0.0.7:8080" {
+		t.Errorf("runner URL = %q, want http://10.0.0.7:8080", runnerURL)
+	}
+	assertJobDeleted(t, client)
+}
+
+func TestWithRunnerDeletesJobWhenPodFails(t *testing.T) {
+	failed := runnerPod(v1.PodFailed, false)
+	failed.Status.ContainerStatuses = []v1.ContainerStatus{{
+		Name:  "runner",
+		State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: "Error", ExitCode: 1}},
+	}}
+	launcher, client := newTestLauncher(runnerPod(v1.PodPending, false), failed)
+
+	called := false
+	err := launcher.WithRunner(context.Background(), OperatorData{ProjectName: "demo"}, func(string) error {
+		called = true
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "failed: Error (exit code 1)") {
+		t.Errorf("WithRunner error = %v, want the pod failure", err)
+	}
+	if called {
+		t.Error("fn was called for a failed runner pod")
+	}
+	assertJobDeleted(t, client)
+}
+
+func TestWithRunnerDeletesJobWhenRunnerCallFails(t *testing.T) {
+	launcher, client := newTestLauncher(runnerPod(v1.PodRunning, true))
+
+	callErr := errors.New("runner answered 500")
+	err := launcher.WithRunner(context.Background(), OperatorData{ProjectName: "demo"}, func(string) error {
+		return callErr
+	})
+	if !errors.Is(err, callErr) {
+		t.Errorf("WithRunner error = %v, want %v", err, callErr)
+	}
+	assertJobDeleted(t, client)
+}
@@ -1,133 +1,302 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
-	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"osdk-runner/generator"
 )
 
-func RunOperatorSDK(data OperatorData) (string, error) {
+// RunOperatorSDK generates the project described by data. If project is not
+// nil, it is the zip archive of an existing project to which only the new
+// APIs and webhooks of data are added. It returns either the path of a zip
+// archive or of a project directory, plus the generator's report. The
+// OnPhase and OnEvent hooks of progress, if set, are called as the
+// generation progresses, also when it runs in a runner pod.
+func RunOperatorSDK(ctx context.Context, data OperatorData, project []byte, progress generator.Generator) (string, *generator.Result, error) {
+	if progress.OnPhase == nil {
+		progress.OnPhase = func(generator.Phase) {}
+	}
+	if progress.OnEvent == nil {
+		progress.OnEvent = func(generator.Event) {}
+	}
 	if executionMode == "kubernetes" {
-		return runOperatorSDKInKubernetes(data)
+		return runOperatorSDKInKubernetes(ctx, data, project, progress)
 	}
-	// return runOperatorSDKLocally(data)
-	return "", fmt.Errorf("local execution mode is not implemented yet")
+	return runOperatorSDKLocally(ctx, data, project, progress)
 }
 
-func runOperatorSDKInKubernetes(data OperatorData) (string, error) {
-	config, err := rest.InClusterConfig()
+// runOperatorSDKLocally runs the generator in-process on this machine and
+// returns the directory containing the generated project. operator-sdk and
+// go must be available on the PATH.
+func runOperatorSDKLocally(ctx context.Context, data OperatorData, project []byte, g generator.Generator) (string, *generator.Result, error) {
+	projectDir, err := os.MkdirTemp("", "sdk-")
 	if err != nil {
-		return "", fmt.Errorf("failed to get in-cluster config: %w", err)
+		return "", nil, fmt.Errorf("failed to create project directory: %w", err)
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	log.Printf("Generating project locally in %s", projectDir)
+	g.ModCache, g.Offline = localModCache, localOffline
+	var result *generator.Result
+	if project != nil {
+		result, err = generateIncrementally(ctx, g, data, project, projectDir)
+	} else {
+		result, err = g.Generate(ctx, data, projectDir)
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to create Kubernetes client: %w", err)
+		os.RemoveAll(projectDir)
+		return "", nil, fmt.Errorf("local generation failed: %w", err)
 	}
 
-	runnerNamespace := os.Getenv("OPERATOR_SDK_RUNNER_NAMESPACE")
+	return result.Dir, result, nil
+}
+
+// PreviewOperatorSDK generates the project described by data and returns its
+// file tree and text file contents instead of an archive.
+func PreviewOperatorSDK(ctx context.Context, data OperatorData) (*generator.Preview, error) {
+	if executionMode == "kubernetes" {
+		return previewOperatorSDKInKubernetes(ctx, data)
+	}
 
-	// Generate a unique pod name using timestamp and project name
-	uniquePodName := fmt.Sprintf("%s-%s-%d", os.Getenv("OPERATOR_SDK_RUNNER_NAME"), strings.ToLower(data.ProjectName), time.Now().Unix())
+	projectDir, result, err := runOperatorSDKLocally(ctx, data, nil, generator.Generator{})
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(projectDir)
+	return result.Preview()
+}
 
-	pod := &v1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      uniquePodName,
-			Namespace: runnerNamespace,
-		},
-		Spec: v1.PodSpec{
-			Containers: []v1.Container{
-				{
-					Name:  uniquePodName,
-					Image: os.Getenv("OPERATOR_SDK_RUNNER_IMAGE"),
-				},
-			},
-			RestartPolicy: v1.RestartPolicyNever,
-		},
+// generateIncrementally extracts the existing project archive into
+// projectDir and adds the new APIs and webhooks of data to it.
+func generateIncrementally(ctx context.Context, g generator.Generator, data OperatorData, project []byte, projectDir string) (*generator.Result, error) {
+	archive, err := openArchive(project)
+	if err != nil {
+		return nil, err
 	}
+	if err := generator.ExtractProject(archive, projectDir); err != nil {
+		return nil, fmt.Errorf("failed to extract project archive: %w", err)
+	}
+	return g.GenerateIncremental(ctx, data, projectDir)
+}
 
-	// Create the pod
-	_, err = clientset.CoreV1().Pods(runnerNamespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+func runOperatorSDKInKubernetes(ctx context.Context, data OperatorData, project []byte, progress generator.Generator) (string, *generator.Result, error) {
+	var zipFilePath string
+	result := &generator.Result{}
+	runID, err := newID()
 	if err != nil {
-		return "", fmt.Errorf("failed to create pod: %w", err)
+		return "", nil, err
 	}
+	err = withRunner(ctx, data, func(runnerURL string) error {
+		progress.OnPhase(generator.PhaseScaffolding)
+
+		// Follow the runner's steps while it generates. The log may lag
+		// behind the runner's response, so its phases are ignored once the
+		// response arrived and the job moved on.
+		var phaseMu sync.Mutex
+		responded := false
+		logsCtx, cancelLogs := context.WithCancel(ctx)
+		logsDone := make(chan struct{})
+		go func() {
+			defer close(logsDone)
+			phase := generator.PhaseScaffolding
+			err := followRunnerLogs(logsCtx, runnerURL+"/v1/logs?run="+runID, func(e generator.Event) {
+				if e.Phase != "" && e.Phase != phase {
+					phase = e.Phase
+					phaseMu.Lock()
+					if !responded {
+						progress.OnPhase(phase)
+					}
+					phaseMu.Unlock()
+				}
+				progress.OnEvent(e)
+			})
+			if err != nil && logsCtx.Err() == nil {
+				log.Printf("Warning: failed to follow runner logs: %v", err)
+			}
+		}()
+		defer func() {
+			// the runner ends the stream once it is done generating
+			select {
+			case <-logsDone:
+			case <-time.After(5 * time.Second):
+			}
+			cancelLogs()
+			<-logsDone
+		}()
 
-	// Wait for the pod to be ready with a timeout
-	const podWaitTimeout = 120 // seconds
-	const pollInterval = 2     // seconds
-	startTime := time.Now()
-	var runnerPod v1.Pod
-	for {
-		p, err := clientset.CoreV1().Pods(runnerNamespace).Get(context.TODO(), uniquePodName, metav1.GetOptions{})
+		// Call the /v1/run endpoint with OperatorData
+		resp, err := postToRunner(ctx, runnerURL+"/v1/run", runID, data, project)
+		phaseMu.Lock()
+		responded = true
+		phaseMu.Unlock()
 		if err != nil {
-			return "", fmt.Errorf("failed to get pod status: %w", err)
+			return err
 		}
+		defer resp.Body.Close()
+		progress.OnPhase(generator.PhaseZipping)
 
-		if p.Status.Phase == v1.PodRunning {
-			runnerPod = *p
-			break
-		} else if p.Status.Phase == v1.PodFailed {
-			return "", fmt.Errorf("pod failed: %s", p.Status.Message)
+		if report := resp.Header.Get(generator.ResultHeader); report != "" {
+			if err := json.Unmarshal([]byte(report), result); err != nil {
+				log.Printf("Warning: failed to parse generation report: %v", err)
+			}
 		}
 
-		if time.Since(startTime).Seconds() > float64(podWaitTimeout) {
-			return "", fmt.Errorf("timed out waiting for pod to be ready")
+		// Save the zip file locally with a prefix related to the HTTP payload
+		zipFile, err := os.CreateTemp("", data.ProjectName+"_output_*.zip")
+		if err != nil {
+			return fmt.Errorf("failed to create zip file: %w", err)
 		}
-
-		time.Sleep(time.Duration(pollInterval) * time.Second)
-	}
-
-	// Call the /v1/run endpoint with OperatorData
-	httpClient := &http.Client{}
-	url := "http://" + runnerPod.Status.PodIP + ":8080/v1/run"
-	jsonData, err := json.Marshal(data)
+		defer zipFile.Close()
+		zipFilePath = zipFile.Name()
+		if _, err := io.Copy(zipFile, resp.Body); err != nil {
+			os.Remove(zipFilePath)
+			return fmt.Errorf("failed to save zip file: %w", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal OperatorData: %w", err)
+		return "", nil, err
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	return zipFilePath, result, nil
+}
+
+// followRunnerLogs reads the runner's Server-Sent Events stream at url and
+// calls fn for every step event until the stream ends.
+func followRunnerLogs(ctx context.Context, url string, fn func(generator.Event)) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create HTTP request: %w", err)
+		return fmt.Errorf("failed to create HTTP request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := httpClient.Do(req)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to call /v1/run endpoint: %w", err)
+		return fmt.Errorf("failed to call %s: %w", url, err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("/v1/run endpoint returned status: %s", resp.Status)
+		return fmt.Errorf("%s returned status: %s", url, resp.Status)
 	}
 
-	// Save the zip file locally with a prefix related to the HTTP payload
-	zipFileName := fmt.Sprintf("%s_output.zip", data.ProjectName)
-	zipFilePath := filepath.Join(os.TempDir(), zipFileName)
-	zipFile, err := os.Create(zipFilePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create zip file: %w", err)
+	scanner := bufio.NewScanner(resp.Body)
+	// command output can make for long lines
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var name, payload string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if name == "end" {
+				return nil
+			}
+			if name == "step" && payload != "" {
+				var e generator.Event
+				if err := json.Unmarshal([]byte(payload), &e); err != nil {
+					log.Printf("Warning: failed to parse runner event: %v", err)
+				} else {
+					fn(e)
+				}
+			}
+			name, payload = "", ""
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			payload += strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
 	}
-	defer zipFile.Close()
-	if _, err := io.Copy(zipFile, resp.Body); err != nil {
-		return "", fmt.Errorf("failed to save zip file: %w", err)
+	return scanner.Err()
+}
+
+func previewOperatorSDKInKubernetes(ctx context.Context, data OperatorData) (*generator.Preview, error) {
+	preview := &generator.Preview{}
+	err := withRunner(ctx, data, func(runnerURL string) error {
+		resp, err := postToRunner(ctx, runnerURL+"/v1/preview", "", data, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if err := json.NewDecoder(resp.Body).Decode(preview); err != nil {
+			return fmt.Errorf("failed to decode preview: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return preview, nil
+}
 
-	// Clean up the pod
-	err = clientset.CoreV1().Pods(runnerNamespace).Delete(context.TODO(), uniquePodName, metav1.DeleteOptions{})
+// postToRunner sends data to a runner endpoint and returns the response if
+// the runner answered with 200 OK. runID names the generation's log stream.
+// If project is not nil, it is sent along as the archive of the existing
+// project in a multipart request.
+func postToRunner(ctx context.Context, url, runID string, data OperatorData, project []byte) (*http.Response, error) {
+	httpClient := &http.Client{}
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal OperatorData: %w", err)
+	}
+	body, contentType := bytes.NewBuffer(jsonData), "application/json"
+	if project != nil {
+		body = &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		if err := form.WriteField("data", string(jsonData)); err != nil {
+			return nil, err
+		}
+		part, err := form.CreateFormFile("project", "project.zip")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write(project); err != nil {
+			return nil, err
+		}
+		if err := form.Close(); err != nil {
+			return nil, err
+		}
+		contentType = form.FormDataContentType()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if runID != "" {
+		req.Header.Set(generator.RunIDHeader, runID)
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		log.Printf("Warning: failed to delete pod %s: %v", uniquePodName, err)
+		return nil, fmt.Errorf("failed to call %s: %w", url, err)
 	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 16*1024*1024))
+		// pass the runner's error through as is
+		genErr := &generator.Error{}
+		if err := json.Unmarshal(body, genErr); err == nil && genErr.Message != "" {
+			return nil, &runnerError{status: resp.StatusCode, err: genErr}
+		}
+		return nil, &runnerError{status: resp.StatusCode, err: fmt.Errorf("%s returned status: %s: %s", url, resp.Status, strings.TrimSpace(string(body)))}
+	}
+	return resp, nil
+}
 
-	return zipFilePath, nil
+// runnerError is an error answered by a runner, kept with its status code so
+// that client errors such as an invalid payload stay 4xx.
+type runnerError struct {
+	status int
+	err    error
 }
+
+func (e *runnerError) Error() string { return e.err.Error() }
+
+func (e *runnerError) Unwrap() error { return e.err }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"osdk-runner/generator"
+)
+
+func TestPostToRunnerKeepsStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantMessage string
+	}{
+		{
+			name:        "invalid payload",
+			status:      http.StatusBadRequest,
+			body:        `{"error":"Invalid request payload","details":"unexpected EOF"}`,
+			wantMessage: "Invalid request payload",
+		},
+		{
+			name:        "failed step",
+			status:      http.StatusInternalServerError,
+			body:        `{"error":"Failed to create webhooks","step":"create-webhook","crd":"Foo"}`,
+			wantMessage: "Failed to create webhooks",
+		},
+		{
+			name:   "plain text",
+			status: http.StatusBadGateway,
+			body:   "upstream unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer runner.Close()
+
+			_, err := postToRunner(context.Background(), runner.URL, "", OperatorData{}, nil)
+			if err == nil {
+				t.Fatal("postToRunner succeeded, want an error")
+			}
+
+			gin.SetMode(gin.TestMode)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			respondError(c, err)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			var body generator.Error
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if tt.wantMessage != "" && body.Message != tt.wantMessage {
+				t.Errorf("error = %q, want %q", body.Message, tt.wantMessage)
+			}
+		})
+	}
+}
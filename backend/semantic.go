@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"osdk-runner/generator"
+)
+
+// FieldError is a semantic problem with one field of an OperatorData
+// document, addressed by its JSON path such as crds[1].properties[2].
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// webhookTypes are the webhook types operator-sdk can scaffold.
+var webhookTypes = map[string]bool{"mutating": true, "validating": true, "conversion": true}
+
+// webhookOperations are the operations admission webhooks can intercept.
+var webhookOperations = map[string]bool{"CREATE": true, "UPDATE": true, "DELETE": true, "CONNECT": true, "*": true}
+
+// selectorOperators are the operators of label selector requirements.
+var selectorOperators = map[string]bool{"In": true, "NotIn": true, "Exists": true, "DoesNotExist": true}
+
+// boundPairs are validations whose lower bound must not exceed the upper one.
+var boundPairs = [][2]string{
+	{"minimum", "maximum"},
+	{"minLength", "maxLength"},
+	{"minItems", "maxItems"},
+	{"minProperties", "maxProperties"},
+}
+
+// ValidateSemantics finds the problems of data that its struct tags cannot
+// express and that would otherwise only fail inside operator-sdk or
+// controller-gen, or not at all.
+func ValidateSemantics(data OperatorData) []FieldError {
+	var errs []FieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	seenKinds := map[string]int{}
+	for i, crd := range data.CRDs {
+		path := fmt.Sprintf("crds[%d]", i)
+
+		if crd.Kind != "" && !isExportedIdentifier(crd.Kind) {
+			add(path+".kind", "kind %q is not a valid exported Go identifier", crd.Kind)
+		}
+		versions := []string{crd.Version}
+		if len(crd.Versions) > 0 {
+			if crd.Version != "" {
+				add(path+".version", "set either version or versions, not both")
+			}
+			versions = nil
+			storage := 0
+			for j, version := range crd.Versions {
+				versionPath := fmt.Sprintf("%s.versions[%d]", path, j)
+				if slices.Contains(versions, version.Name) {
+					add(versionPath+".name", "version %q is listed twice", version.Name)
+				} else {
+					versions = append(versions, version.Name)
+				}
+				if version.Storage {
+					storage++
+				}
+				errs = append(errs, validateProperties(versionPath+".properties", version.Properties)...)
+				errs = append(errs, validateProperties(versionPath+".statusProperties", version.StatusProperties)...)
+				errs = append(errs, validateTypeNames(versionPath+".properties", crd.Kind+"Spec", version.Properties, map[string]string{})...)
+				errs = append(errs, validateTypeNames(versionPath+".statusProperties", crd.Kind+"Status", version.StatusProperties, map[string]string{})...)
+			}
+			if len(crd.Versions) > 1 && storage != 1 {
+				add(path+".versions", "exactly one version must be the storage version, found %d", storage)
+			}
+		}
+		for _, version := range versions {
+			gvk := crd.Group + "/" + version + "/" + crd.Kind
+			if first, ok := seenKinds[gvk]; ok {
+				add(path+".kind", "kind %q is already defined in group %q version %q by crds[%d]", crd.Kind, crd.Group, version, first)
+			} else {
+				seenKinds[gvk] = i
+			}
+		}
+
+		seenWebhooks := map[string]int{}
+		for j, webhook := range crd.Webhooks {
+			webhookPath := fmt.Sprintf("%s.webhooks[%d]", path, j)
+			if !webhookTypes[webhook.Type] {
+				add(webhookPath+".type", "unknown webhook type %q, expected mutating, validating or conversion", webhook.Type)
+				continue
+			}
+			switch first, ok := seenWebhooks[webhook.Type]; {
+			case !webhook.IsEnabled():
+				// disabled webhooks are not scaffolded, so they cannot conflict
+			case ok:
+				add(webhookPath+".type", "a %s webhook is already configured by %s.webhooks[%d]", webhook.Type, path, first)
+			default:
+				seenWebhooks[webhook.Type] = j
+			}
+			for k, operation := range webhook.Operations {
+				if !webhookOperations[strings.ToUpper(operation)] {
+					add(fmt.Sprintf("%s.operations[%d]", webhookPath, k), "unknown operation %q, expected CREATE, UPDATE, DELETE, CONNECT or *", operation)
+				}
+			}
+			if webhook.TimeoutSeconds != 0 && (webhook.TimeoutSeconds < 1 || webhook.TimeoutSeconds > 30) {
+				add(webhookPath+".timeoutSeconds", "timeoutSeconds must be between 1 and 30, got %d", webhook.TimeoutSeconds)
+			}
+			errs = append(errs, validateSelector(webhookPath+".namespaceSelector", webhook.NamespaceSelector)...)
+			errs = append(errs, validateSelector(webhookPath+".objectSelector", webhook.ObjectSelector)...)
+		}
+
+		errs = append(errs, validateProperties(path+".properties", crd.Properties)...)
+		errs = append(errs, validateProperties(path+".statusProperties", crd.StatusProperties)...)
+		errs = append(errs, validateTypeNames(path+".properties", crd.Kind+"Spec", crd.Properties, map[string]string{})...)
+		errs = append(errs, validateTypeNames(path+".statusProperties", crd.Kind+"Status", crd.StatusProperties, map[string]string{})...)
+	}
+	return errs
+}
+
+// validateSelector checks the requirements of a webhook's label selector.
+func validateSelector(path string, selector *generator.LabelSelector) []FieldError {
+	if selector == nil {
+		return nil
+	}
+	var errs []FieldError
+	for i, requirement := range selector.MatchExpressions {
+		requirementPath := fmt.Sprintf("%s.matchExpressions[%d]", path, i)
+		switch {
+		case requirement.Key == "":
+			errs = append(errs, FieldError{Field: requirementPath + ".key", Message: "key must not be empty"})
+		case !selectorOperators[requirement.Operator]:
+			errs = append(errs, FieldError{Field: requirementPath + ".operator",
+				Message: fmt.Sprintf("unknown operator %q, expected In, NotIn, Exists or DoesNotExist", requirement.Operator)})
+		case (requirement.Operator == "In" || requirement.Operator == "NotIn") && len(requirement.Values) == 0:
+			errs = append(errs, FieldError{Field: requirementPath + ".values", Message: requirement.Operator + " needs at least one value"})
+		case (requirement.Operator == "Exists" || requirement.Operator == "DoesNotExist") && len(requirement.Values) > 0:
+			errs = append(errs, FieldError{Field: requirementPath + ".values", Message: requirement.Operator + " takes no values"})
+		}
+	}
+	return errs
+}
+
+// validateProperties checks the properties at path and their children.
+func validateProperties(path string, props []generator.Property) []FieldError {
+	var errs []FieldError
+	seenFields := map[string]int{}
+	for i, p := range props {
+		propPath := fmt.Sprintf("%s[%d]", path, i)
+		errs = append(errs, validateProperty(propPath, p)...)
+
+		fieldName := generator.ToCamelCase(p.Name)
+		if !isExportedIdentifier(fieldName) {
+			errs = append(errs, FieldError{Field: propPath + ".name",
+				Message: fmt.Sprintf("name %q becomes the Go field %q, which is not a valid exported identifier", p.Name, fieldName)})
+			continue
+		}
+		if first, ok := seenFields[fieldName]; ok {
+			errs = append(errs, FieldError{Field: propPath + ".name",
+				Message: fmt.Sprintf("name %q becomes the Go field %s, like %s[%d]", p.Name, fieldName, path, first)})
+		} else {
+			seenFields[fieldName] = i
+		}
+	}
+	return errs
+}
+
+// validateTypeNames checks that the structs the generator declares for the
+// object properties at path, nested in the Go type typeName, get distinct
+// names. seen maps the names declared so far to the paths declaring them.
+func validateTypeNames(path, typeName string, props []generator.Property, seen map[string]string) []FieldError {
+	var errs []FieldError
+	for i, p := range props {
+		errs = append(errs, validateTypeName(fmt.Sprintf("%s[%d]", path, i), typeName+generator.ToCamelCase(p.Name), p, seen)...)
+	}
+	return errs
+}
+
+// validateTypeName checks the name of the struct declared for p, and of the
+// structs nested in it, the same way the generator names them: an object
+// with properties becomes name, the items of an array name+"Item".
+func validateTypeName(path, name string, p generator.Property, seen map[string]string) []FieldError {
+	switch {
+	case p.Type == "object" && len(p.Properties) > 0:
+		if first, ok := seen[name]; ok {
+			return []FieldError{{Field: path, Message: fmt.Sprintf("becomes the Go type %s, like %s", name, first)}}
+		}
+		seen[name] = path
+		return validateTypeNames(path+".properties", name, p.Properties, seen)
+	case p.Type == "array" && p.Items != nil:
+		return validateTypeName(path+".items", name+"Item", *p.Items, seen)
+	}
+	return nil
+}
+
+// validateProperty checks the validations of p and its nested schemas.
+func validateProperty(path string, p generator.Property) []FieldError {
+	var errs []FieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	bounds := map[string]float64{}
+	boundIndex := map[string]int{}
+	exclusive := false
+	for i, v := range p.Validations {
+		validationPath := fmt.Sprintf("%s.validations[%d]", path, i)
+		switch v.Type {
+		case "exclusiveMinimum", "exclusiveMaximum":
+			if b, ok := v.Value.(bool); ok && b {
+				exclusive = true
+			}
+		case "pattern", "itemsPattern":
+			if s, ok := v.Value.(string); ok && s != "" {
+				if _, err := regexp.Compile(s); err != nil {
+					add(validationPath, "pattern %q does not compile: %v", s, err)
+				}
+			}
+		}
+		for _, pair := range boundPairs {
+			if v.Type != pair[0] && v.Type != pair[1] {
+				continue
+			}
+			if s, ok := v.Value.(string); ok && s == "" {
+				// empty values are ignored by the generator
+				continue
+			}
+			n, ok := numericValue(v.Value)
+			if !ok {
+				add(validationPath, "%s must be a number, got %v", v.Type, v.Value)
+				continue
+			}
+			bounds[v.Type] = n
+			boundIndex[v.Type] = i
+		}
+	}
+	for _, pair := range boundPairs {
+		lower, hasLower := bounds[pair[0]]
+		upper, hasUpper := bounds[pair[1]]
+		if hasLower && hasUpper && lower > upper {
+			add(fmt.Sprintf("%s.validations[%d]", path, boundIndex[pair[0]]),
+				"%s %v is greater than %s %v", pair[0], lower, pair[1], upper)
+		} else if pair[0] == "minimum" && exclusive && hasLower && hasUpper && lower == upper {
+			add(fmt.Sprintf("%s.validations[%d]", path, boundIndex[pair[0]]),
+				"minimum and maximum are both %v but one of them is exclusive, so no value is valid", lower)
+		}
+	}
+
+	if len(p.Properties) > 0 {
+		errs = append(errs, validateProperties(path+".properties", p.Properties)...)
+	}
+	if p.Items != nil {
+		for i, v := range p.Items.Validations {
+			if strings.HasPrefix(v.Type, "items") {
+				add(fmt.Sprintf("%s.items.validations[%d]", path, i), "%s applies to arrays, set it on the array instead of its items", v.Type)
+			}
+		}
+		errs = append(errs, validateProperty(path+".items", *p.Items)...)
+	}
+	return errs
+}
+
+// numericValue reads a validation value sent as a JSON number or string.
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		n, err := strconv.ParseFloat(v, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func isExportedIdentifier(name string) bool {
+	return token.IsIdentifier(name) && unicode.IsUpper([]rune(name)[0])
+}
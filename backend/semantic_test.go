@@ -0,0 +1,140 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"osdk-runner/generator"
+)
+
+func TestValidateSemantics(t *testing.T) {
+	object := func(name string, props ...generator.Property) generator.Property {
+		return generator.Property{Name: name, Type: "object", Properties: props}
+	}
+	array := func(name string, items generator.Property) generator.Property {
+		return generator.Property{Name: name, Type: "array", Items: &items}
+	}
+	str := generator.Property{Name: "value", Type: "string"}
+	disabled := false
+
+	tests := []struct {
+		name string
+		crds []generator.CRD
+		want []string // the fields of the expected errors
+	}{
+		{
+			name: "valid",
+			crds: []generator.CRD{{Group: "apps", Version: "v1", Kind: "Foo", Properties: []generator.Property{
+				object("database", str), array("ports", object("", str)),
+			}}},
+		},
+		{
+			name: "kind is not an exported identifier",
+			crds: []generator.CRD{{Group: "apps", Version: "v1", Kind: "foo"}},
+			want: []string{"crds[0].kind"},
+		},
+		{
+			name: "kind defined twice",
+			crds: []generator.CRD{{Group: "apps", Version: "v1", Kind: "Foo"}, {Group: "apps", Version: "v1", Kind: "Foo"}},
+			want: []string{"crds[1].kind"},
+		},
+		{
+			name: "version and versions",
+			crds: []generator.CRD{{Group: "apps", Version: "v1", Kind: "Foo", Versions: []generator.CRDVersion{{Name: "v1", Storage: true}, {Name: "v1"}}}},
+			want: []string{"crds[0].version", "crds[0].versions[1].name"},
+		},
+		{
+			name: "no storage version",
+			crds: []generator.CRD{{Group: "apps", Kind: "Foo", Versions: []generator.CRDVersion{{Name: "v1"}, {Name: "v2"}}}},
+			want: []string{"crds[0].versions"},
+		},
+		{
+			name: "webhooks",
+			crds: []generator.CRD{{Group: "apps", Version: "v1", Kind: "Foo", Webhooks: []generator.WebhookConfig{
+				{Type: "mutating", Operations: []string{"create", "PATCH"}, TimeoutSeconds: 31},
+				{Type: "mutating", Enabled: &disabled},
+				{Type: "mutating"},
+				{Type: "defaulting"},
+				{Type: "validating", NamespaceSelector: &generator.LabelSelector{MatchExpressions: []generator.LabelSelectorRequirement{
+					{Key: "env", Operator: "In"},
+					{Key: "env", Operator: "Exists", Values: []string{"x"}},
+					{Key: "env", Operator: "Has"},
+					{Operator: "Exists"},
+				}}},
+			}}},
+			want: []string{
+				"crds[0].webhooks[0].operations[1]",
+				"crds[0].webhooks[0].timeoutSeconds",
+				"crds[0].webhooks[2].type",
+				"crds[0].webhooks[3].type",
+				"crds[0].webhooks[4].namespaceSelector.matchExpressions[0].values",
+				"crds[0].webhooks[4].namespaceSelector.matchExpressions[1].values",
+				"crds[0].webhooks[4].namespaceSelector.matchExpressions[2].operator",
+				"crds[0].webhooks[4].namespaceSelector.matchExpressions[3].key",
+			},
+		},
+		{
+			name: "property names",
+			crds: []generator.CRD{{Group: "apps", Version: "v1", Kind: "Foo", Properties: []generator.Property{
+				{Name: "foo_bar", Type: "string"}, {Name: "fooBar", Type: "string"}, {Name: "9lives", Type: "string"},
+			}}},
+			want: []string{"crds[0].properties[1].name", "crds[0].properties[2].name"},
+		},
+		{
+			name: "validations",
+			crds: []generator.CRD{{Group: "apps", Version: "v1", Kind: "Foo", Properties: []generator.Property{
+				{Name: "size", Type: "integer", Validations: []generator.Validation{{Type: "minimum", Value: "5"}, {Type: "maximum", Value: 3.0}}},
+				{Name: "port", Type: "integer", Validations: []generator.Validation{{Type: "minimum", Value: "1"}, {Type: "maximum", Value: "1"}, {Type: "exclusiveMaximum", Value: true}}},
+				{Name: "name", Type: "string", Validations: []generator.Validation{{Type: "pattern", Value: "("}, {Type: "maxLength", Value: "ten"}, {Type: "minLength", Value: ""}}},
+				array("tags", generator.Property{Type: "string", Validations: []generator.Validation{{Type: "itemsPattern", Value: "^a$"}}}),
+			}}},
+			want: []string{
+				"crds[0].properties[0].validations[0]",
+				"crds[0].properties[1].validations[0]",
+				"crds[0].properties[2].validations[0]",
+				"crds[0].properties[2].validations[1]",
+				"crds[0].properties[3].items.validations[0]",
+			},
+		},
+		{
+			name: "nested type collides with field type",
+			crds: []generator.CRD{{Group: "apps", Version: "v1", Kind: "Foo", Properties: []generator.Property{
+				object("fooBar", str), object("foo", object("bar", str)),
+			}}},
+			want: []string{"crds[0].properties[1].properties[0]"},
+		},
+		{
+			name: "array items collide with field type",
+			crds: []generator.CRD{{Group: "apps", Version: "v1", Kind: "Foo", StatusProperties: []generator.Property{
+				array("foo", object("", str)), object("fooItem", str),
+			}}},
+			want: []string{"crds[0].statusProperties[1]"},
+		},
+		{
+			name: "spec and status types do not collide",
+			crds: []generator.CRD{{Group: "apps", Version: "v1", Kind: "Foo",
+				Properties:       []generator.Property{object("foo", str)},
+				StatusProperties: []generator.Property{object("foo", str)},
+			}},
+		},
+		{
+			name: "type collision in a version",
+			crds: []generator.CRD{{Group: "apps", Kind: "Foo", Versions: []generator.CRDVersion{
+				{Name: "v1", Storage: true},
+				{Name: "v2", Properties: []generator.Property{object("a_b", str), object("a", object("b", str))}},
+			}}},
+			want: []string{"crds[0].versions[1].properties[1].properties[0]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, err := range ValidateSemantics(OperatorData{CRDs: tt.crds}) {
+				got = append(got, err.Field)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateSemantics() errors for %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
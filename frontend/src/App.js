@@ -49,6 +49,37 @@ function App() {
     );
   }, [domain, repo, projectName, namespaced, namespaces, crds]);
 
+  // The backend reports ignored input (e.g. unknown validations) in a JSON header
+  const parseGenerationWarnings = (header) => {
+    if (!header) return [];
+    try {
+      const { warnings = [] } = JSON.parse(header);
+      return warnings.map(w => {
+        const where = [w.crd, w.field].filter(Boolean).join(' ');
+        return where ? `${where}: ${w.message}` : w.message;
+      });
+    } catch (error) {
+      console.error('Failed to parse generation report:', error);
+      return [];
+    }
+  };
+
+  // Failed steps come back as { error, step, crd, command, exitCode, stderr, hint, details }
+  const formatGenerationError = (text) => {
+    try {
+      const { error, step, crd, command, exitCode, stderr, hint, details } = JSON.parse(text);
+      const lines = [error];
+      if (step) lines.push(`Step: ${step}${crd ? ` (${crd})` : ''}`);
+      if (command) lines.push(`Command: ${command.join(' ')}${exitCode ? ` (exit code ${exitCode})` : ''}`);
+      if (hint) lines.push(`Hint: ${hint}`);
+      const output = stderr || details;
+      if (output) lines.push('', output);
+      return lines.join('\n');
+    } catch (error) {
+      return text;
+    }
+  };
+
   const downloadFile = async (response, filename) => {
     const contentLength = response.headers.get('content-length');
     const total = parseInt(contentLength, 10);
@@ -136,10 +167,14 @@ function App() {
       if (response.ok) {
         const filename = `${data.projectName || 'operator-sdk-project'}.zip`;
         await downloadFile(response, filename);
+        const warnings = parseGenerationWarnings(response.headers.get('X-Osdk-Result'));
+        if (warnings.length > 0) {
+          alert(`Generated with warnings:\n${warnings.join('\n')}`);
+        }
       } else {
         const errorText = await response.text();
         console.error('Generation failed:', errorText);
-        alert(`Generation failed: ${errorText}`);
+        alert(`Generation failed: ${formatGenerationError(errorText)}`);
       }
     } catch (error) {
       console.error('Error sending data to backend:', error);
@@ -326,6 +361,7 @@ function App() {
                       
                       const updatedWebhooks = [...currentWebhooks, { 
                         type: webhookType, 
+                        enabled: true,
                         failurePolicy: 'Fail',
                         sideEffects: 'None',
                         matchPolicy: 'Exact',
@@ -30,6 +30,10 @@ const WEBHOOK_FIELDS = [
     key: 'webhookresources', label: 'Resources',
     help: '<p><b>Resources:</b> The Kubernetes resource types this webhook should watch (e.g., pods, deployments, services).</p>'
   },
+  {
+    key: 'webhooktimeout', label: 'Timeout (seconds)',
+    help: '<p><b>Timeout:</b> How long the API server waits for the webhook, between 1 and 30 seconds. Defaults to 10.</p>'
+  },
 ];
 
 // Wrapper for wa-checkbox to sync the 'checked' property on first render
@@ -154,6 +158,12 @@ function WebhookConfiguration({
                 <wa-option value="validating">Validating Webhook</wa-option>
                 <wa-option value="conversion">Conversion Webhook</wa-option>
               </LabeledSelect>
+              <WACheckbox
+                checked={webhook.enabled !== false}
+                onChange={e => updateWebhook(idx, 'enabled', e.target.checked)}
+              >
+                Enabled
+              </WACheckbox>
               <wa-button
                 variant="danger"
                 size="small"
@@ -249,7 +259,7 @@ function WebhookConfiguration({
               </form>
             </div>
 
-            <div style={{ marginBottom: '0.75rem' }}>
+            <div style={{ display: 'grid', gridTemplateColumns: '1fr 1fr', gap: '0.5rem', marginBottom: '0.75rem', overflow: 'visible', position: 'static' }}>
               <LabeledInput
                 id={`webhookresources-${idx}`}
                 label={WEBHOOK_FIELDS.find(f => f.key === 'webhookresources')?.label}
@@ -263,6 +273,16 @@ function WebhookConfiguration({
                   updateWebhook(idx, 'resources', resources);
                 }}
               />
+              <LabeledInput
+                id={`webhooktimeout-${idx}`}
+                label={WEBHOOK_FIELDS.find(f => f.key === 'webhooktimeout')?.label}
+                placeholder="10"
+                value={webhook.timeoutSeconds ? String(webhook.timeoutSeconds) : ''}
+                onChange={e => {
+                  const timeout = parseInt(e.target.value, 10);
+                  updateWebhook(idx, 'timeoutSeconds', Number.isNaN(timeout) ? 0 : timeout);
+                }}
+              />
             </div>
           </div>
         ))}
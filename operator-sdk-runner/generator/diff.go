@@ -0,0 +1,325 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around every hunk.
+const diffContext = 3
+
+// maxEditDistance bounds the work of diffLines; files that differ in more
+// lines are diffed as a whole removal and addition.
+const maxEditDistance = 4000
+
+// DiffDirs writes a git-style unified diff that turns the project in baseDir
+// into the one in dir, which git apply accepts. The generator's caches, .git
+// and output.zip are left out, as are binary files.
+func DiffDirs(w io.Writer, baseDir, dir string) error {
+	baseFiles, err := projectFiles(baseDir)
+	if err != nil {
+		return err
+	}
+	files, err := projectFiles(dir)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	for path := range baseFiles {
+		if _, ok := files[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		var before, after []byte
+		var mode fs.FileMode
+		if info, ok := baseFiles[path]; ok {
+			if before, err = os.ReadFile(filepath.Join(baseDir, path)); err != nil {
+				return err
+			}
+			mode = info.Mode()
+		}
+		if info, ok := files[path]; ok {
+			if after, err = os.ReadFile(filepath.Join(dir, path)); err != nil {
+				return err
+			}
+			mode = info.Mode()
+		}
+		_, existed := baseFiles[path]
+		_, exists := files[path]
+		if existed && exists && bytes.Equal(before, after) {
+			continue
+		}
+		if isBinary(before) || isBinary(after) {
+			log.Printf("Skipping binary file in diff: %s", path)
+			continue
+		}
+		if err := writeFileDiff(w, filepath.ToSlash(path), before, after, existed, exists, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// projectFiles returns the regular files below dir by relative path.
+func projectFiles(dir string) (map[string]fs.FileInfo, error) {
+	files := map[string]fs.FileInfo{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == CacheDirName || d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || d.Name() == "output.zip" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[rel] = info
+		return nil
+	})
+	return files, err
+}
+
+func isBinary(content []byte) bool {
+	if len(content) > 8000 {
+		content = content[:8000]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// writeFileDiff writes the diff of one file, which may have been added or
+// removed.
+func writeFileDiff(w io.Writer, path string, before, after []byte, existed, exists bool, mode fs.FileMode) error {
+	gitMode := "100644"
+	if mode&0o111 != 0 {
+		gitMode = "100755"
+	}
+	var header strings.Builder
+	fmt.Fprintf(&header, "diff --git a/%s b/%s\n", path, path)
+	oldName, newName := "a/"+path, "b/"+path
+	switch {
+	case !existed:
+		fmt.Fprintf(&header, "new file mode %s\n", gitMode)
+		oldName = "/dev/null"
+	case !exists:
+		fmt.Fprintf(&header, "deleted file mode %s\n", gitMode)
+		newName = "/dev/null"
+	}
+	if len(before) > 0 || len(after) > 0 {
+		fmt.Fprintf(&header, "--- %s\n+++ %s\n", oldName, newName)
+	}
+	if _, err := io.WriteString(w, header.String()); err != nil {
+		return err
+	}
+	return writeHunks(w, diffLines(splitLines(before), splitLines(after)))
+}
+
+// splitLines splits content after every newline. The last line lacks one
+// if the file does not end with a newline.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffOp is one line of an edit script: ' ' keeps, '-' removes and '+'
+// adds the line.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines returns an edit script turning a into b, using Myers' algorithm
+// between their common prefix and suffix.
+func diffLines(a, b []string) []diffOp {
+	var prefix, suffix []diffOp
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, diffOp{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append(suffix, diffOp{' ', a[len(a)-1]})
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	ops := append(prefix, myers(a, b)...)
+	for i := len(suffix) - 1; i >= 0; i-- {
+		ops = append(ops, suffix[i])
+	}
+	return ops
+}
+
+// myers returns a shortest edit script turning a into b, or one removing
+// all of a and adding all of b when that takes more than maxEditDistance
+// edits.
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	// trace[d] holds v[-d-1..d+1] before step d
+	var trace [][]int
+	for d := 0; d <= max && d <= maxEditDistance; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(a, b, trace)
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, n+m)
+	for _, line := range a {
+		ops = append(ops, diffOp{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffOp{'+', line})
+	}
+	return ops
+}
+
+// backtrack follows the furthest reaching paths recorded in trace back from
+// the end of a and b.
+func backtrack(a, b []string, trace [][]int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d > 0; d-- {
+		get := func(k int) int { return trace[d][k+d+1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && get(k-1) < get(k+1)) {
+			prevK = k + 1
+		}
+		prevX := get(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x, y = x-1, y-1
+		}
+		if x == prevX {
+			ops = append(ops, diffOp{'+', b[y-1]})
+			y--
+		} else {
+			ops = append(ops, diffOp{'-', a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, diffOp{' ', a[x-1]})
+		x, y = x-1, y-1
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// writeHunks writes the changes of ops as unified diff hunks.
+func writeHunks(w io.Writer, ops []diffOp) error {
+	for start := 0; start < len(ops); {
+		// find the next change
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			return nil
+		}
+		// extend the hunk while changes are close enough to share context
+		last := first
+		for i := first; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				last = i
+			} else if i-last > 2*diffContext {
+				break
+			}
+		}
+		from := first - diffContext
+		if from < start {
+			from = start
+		}
+		to := last + diffContext + 1
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		oldStart, newStart := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				oldStart++
+			}
+			if op.kind != '-' {
+				newStart++
+			}
+		}
+		oldLines, newLines := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldLines++
+			}
+			if op.kind != '-' {
+				newLines++
+			}
+		}
+		if oldLines == 0 {
+			oldStart--
+		}
+		if newLines == 0 {
+			newStart--
+		}
+
+		var hunk strings.Builder
+		fmt.Fprintf(&hunk, "@@ -%d,%d +%d,%d @@\n", oldStart, oldLines, newStart, newLines)
+		for _, op := range ops[from:to] {
+			hunk.WriteByte(op.kind)
+			hunk.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				hunk.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		if _, err := io.WriteString(w, hunk.String()); err != nil {
+			return err
+		}
+		start = to
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event describes one finished step of a generation, such as a command run
+// or a patch applied to the scaffolded sources.
+type Event struct {
+	Step  string `json:"step"`
+	Phase Phase  `json:"phase"`
+	CRD   string `json:"crd,omitempty"`
+	// Command is the argv of the command run by the step, if any.
+	Command    []string  `json:"command,omitempty"`
+	Stdout     string    `json:"stdout,omitempty"`
+	Stderr     string    `json:"stderr,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// Steps reported in events.
+const (
+	StepInit          = "init"
+	StepMultiGroup    = "edit-multigroup"
+	StepModTidy       = "go-mod-tidy"
+	StepCreateAPI     = "create-api"
+	StepGoTypes       = "update-go-types"
+	StepRBAC          = "update-rbac"
+	StepCreateWebhook = "create-webhook"
+	StepWebhookPath   = "update-webhook-path"
+	StepConversion    = "setup-conversion"
+	StepMainScope     = "patch-main"
+	StepControllerGen = "controller-gen"
+)
+
+func (g *Generator) emit(e Event) {
+	if g.OnEvent != nil {
+		g.OnEvent(e)
+	}
+}
+
+// runCommand runs cmd, reports it as an event for step and returns its
+// combined output like exec.Cmd.CombinedOutput. A failure is returned as an
+// *Error describing the command.
+func (g *Generator) runCommand(step, crd string, cmd *exec.Cmd) ([]byte, error) {
+	var stdout, stderr, combined bytes.Buffer
+	cmd.Stdout = io.MultiWriter(&stdout, &combined)
+	cmd.Stderr = io.MultiWriter(&stderr, &combined)
+
+	started := time.Now()
+	err := cmd.Run()
+	event := Event{
+		Step:       step,
+		Phase:      g.current,
+		CRD:        crd,
+		Command:    cmd.Args,
+		Stdout:     stdout.String(),
+		Stderr:     stderr.String(),
+		StartedAt:  started,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if err == nil {
+		g.emit(event)
+		return combined.Bytes(), nil
+	}
+	event.Error = err.Error()
+	g.emit(event)
+
+	cmdErr := &Error{
+		Message: err.Error(),
+		Details: combined.String(),
+		Step:    step,
+		CRD:     crd,
+		Command: cmd.Args,
+		Stderr:  stderr.String(),
+		Hint:    hint(stderr.String(), err),
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		cmdErr.ExitCode = exitErr.ExitCode()
+	}
+	return combined.Bytes(), cmdErr
+}
+
+// runStep runs fn and reports it as an event for step. A failure is returned
+// as an *Error for step.
+func (g *Generator) runStep(step, crd string, fn func() error) error {
+	started := time.Now()
+	err := fn()
+	event := Event{
+		Step:       step,
+		Phase:      g.current,
+		CRD:        crd,
+		StartedAt:  started,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if err == nil {
+		g.emit(event)
+		return nil
+	}
+	event.Error = err.Error()
+	g.emit(event)
+	return &Error{Message: err.Error(), Details: err.Error(), Step: step, CRD: crd}
+}
+
+// hints maps fragments of well-known tool errors to a suggested fix.
+var hints = []struct {
+	fragment string
+	hint     string
+}{
+	{"executable file not found", "The tool is not installed on the runner; check the runner image."},
+	{"GOPROXY=off", "A module is missing from the module cache; seed the cache again or allow network access."},
+	{"dial tcp", "A module could not be downloaded; check network access or generate offline from a seeded module cache."},
+	{"already exists", "The resource was scaffolded twice; check for CRDs or webhooks with the same group, version and kind."},
+	{"is not a valid", "Check the naming of the group, version and kind."},
+	{"kind must be PascalCase", "Check the naming of the group, version and kind."},
+	{"version must match", "Check the naming of the group, version and kind."},
+	{"RFC 1123 subdomain must consist", "Check the naming of the group, version and kind."},
+	{"signal: killed", "The command was cancelled or ran out of time or memory."},
+}
+
+// hint suggests a fix for the failure of a command that wrote stderr.
+func hint(stderr string, err error) string {
+	for _, h := range hints {
+		if strings.Contains(stderr, h.fragment) || strings.Contains(err.Error(), h.fragment) {
+			return h.hint
+		}
+	}
+	return ""
+}
+
+// EventLog collects the events of one generation so they can be replayed to
+// any number of followers, including ones that start late.
+type EventLog struct {
+	mu      sync.Mutex
+	events  []Event
+	closed  bool
+	changed chan struct{}
+}
+
+func NewEventLog() *EventLog {
+	return &EventLog{changed: make(chan struct{})}
+}
+
+// Add appends e and wakes up the followers. Events added after Close are dropped.
+func (l *EventLog) Add(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.events = append(l.events, e)
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Close marks the generation as finished, ending every Follow.
+func (l *EventLog) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+	l.closed = true
+	close(l.changed)
+}
+
+// Follow calls fn with every event of the log in order, waiting for new ones
+// until the log is closed, ctx is done or fn returns an error.
+func (l *EventLog) Follow(ctx context.Context, fn func(Event) error) error {
+	next := 0
+	for {
+		l.mu.Lock()
+		pending := l.events[next:]
+		closed := l.closed
+		changed := l.changed
+		l.mu.Unlock()
+
+		for _, e := range pending {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		next += len(pending)
+		if closed {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package generator
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHint(t *testing.T) {
+	naming := "Check the naming of the group, version and kind."
+	tests := []struct {
+		name   string
+		stderr string
+		err    string
+		want   string
+	}{
+		{"kind not PascalCase", "Error: failed to create API: kind must be PascalCase (expected MyApp was myApp)", "exit status 1", naming},
+		{"bad version", "Error: version must match ^v\\d+(?:alpha\\d+|beta\\d+)?$ (was 1)", "exit status 1", naming},
+		{"bad group", "invalid group: a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters", "exit status 1", naming},
+		{"missing tool", "", `exec: "operator-sdk": executable file not found in $PATH`, "The tool is not installed on the runner; check the runner image."},
+		{"unrelated must be", "api/v1/foo_types.go:12:2: field Size must be an int", "exit status 1", ""},
+		{"unrelated kubectl error", "The Deployment \"x\" is invalid: spec.replicas: Invalid value: -1: must be greater than or equal to 0", "exit status 1", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hint(tt.stderr, errors.New(tt.err)); got != tt.want {
+				t.Errorf("hint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
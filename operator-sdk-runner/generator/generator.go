@@ -0,0 +1,512 @@
+// Package generator scaffolds Kubernetes operators with operator-sdk and
+// patches the generated sources according to an OperatorData document.
+// It is used by the runner's HTTP server and CLI and by the backend's local
+// execution mode.
+package generator
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// CacheDirName is the directory inside the project dir that holds the Go
+// caches used while generating. It is never part of the generated project.
+const CacheDirName = ".osdk_cache"
+
+func hasMultipleGroups(crds []CRD) bool {
+	if len(crds) <= 1 {
+		return false
+	}
+
+	firstGroup := crds[0].Group
+	for _, crd := range crds[1:] {
+		if crd.Group != firstGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// ResultHeader is the HTTP response header that carries the JSON-encoded
+// Result next to a generated zip archive.
+const ResultHeader = "X-Osdk-Result"
+
+// RunIDHeader is the HTTP request header that names a generation on a runner,
+// so its log stream can be requested with the same ID.
+const RunIDHeader = "X-Osdk-Run-Id"
+
+// Error describes a failed pipeline step. It is the JSON error body shared by
+// the runner and the backend, so clients can tell which step, CRD and command
+// failed.
+type Error struct {
+	Message string `json:"error"`
+	// Details is the raw tool output or error text.
+	Details string `json:"details,omitempty"`
+	Step    string `json:"step,omitempty"`
+	CRD     string `json:"crd,omitempty"`
+	// Command is the argv of the failed command, if the step ran one.
+	Command  []string `json:"command,omitempty"`
+	ExitCode int      `json:"exitCode,omitempty"`
+	Stderr   string   `json:"stderr,omitempty"`
+	// Hint suggests how to fix a well-known failure.
+	Hint string `json:"hint,omitempty"`
+	// Webhooks reports the webhooks handled before creating webhooks failed.
+	Webhooks []WebhookResult `json:"webhooks,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message + ": " + e.Details
+}
+
+// stepError sets message on the *Error returned by runCommand or runStep, or
+// wraps any other err.
+func stepError(err error, message string) error {
+	var genErr *Error
+	if errors.As(err, &genErr) {
+		genErr.Message = message
+		return genErr
+	}
+	return &Error{Message: message, Details: err.Error()}
+}
+
+// Warning is a non-fatal problem found while generating, such as part of the
+// request that had to be ignored.
+type Warning struct {
+	CRD     string `json:"crd,omitempty"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Result describes a successfully generated project. Everything except Dir
+// is reported back to API clients.
+type Result struct {
+	// Dir is the directory containing the generated project.
+	Dir string `json:"-"`
+	// MultiGroup reports whether the project uses the multigroup layout.
+	MultiGroup bool `json:"multiGroup"`
+	// Warnings lists the parts of the request that were not applied.
+	Warnings []Warning `json:"warnings,omitempty"`
+	// Manifests holds the rendered CRD manifests when RenderManifests was requested.
+	Manifests []Manifest `json:"manifests,omitempty"`
+	// Webhooks reports which of the configured webhooks were created, skipped
+	// or failed.
+	Webhooks []WebhookResult `json:"webhooks,omitempty"`
+}
+
+// HeaderValue encodes the result for ResultHeader. Manifest contents are
+// left out as they are part of the archive anyway.
+func (r *Result) HeaderValue() (string, error) {
+	report := *r
+	report.Manifests = nil
+	for _, m := range r.Manifests {
+		m.YAML = ""
+		report.Manifests = append(report.Manifests, m)
+	}
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// Phase is a coarse stage of a generation, reported to Generator.OnPhase.
+type Phase string
+
+const (
+	// PhaseScaffolding covers operator-sdk init, go mod tidy and create api.
+	PhaseScaffolding Phase = "scaffolding"
+	// PhasePatching covers rewriting the scaffolded sources, creating
+	// webhooks and rendering manifests.
+	PhasePatching Phase = "patching"
+	// PhaseZipping is entered by callers while they archive the result.
+	PhaseZipping Phase = "zipping"
+)
+
+// Generator runs the generation pipeline. The zero value is ready to use.
+type Generator struct {
+	// OnPhase, if set, is called whenever the generation enters a new phase.
+	OnPhase func(Phase)
+	// OnEvent, if set, is called after every step with its command, output
+	// and duration.
+	OnEvent func(Event)
+	// CacheDir, if set, holds Go build and module caches shared by all
+	// generations of this Generator, so modules are only downloaded once.
+	// By default every project gets its own caches below CacheDirName.
+	CacheDir string
+	// ModCache, if set, is a pre-seeded Go module cache used as GOMODCACHE
+	// instead of the one in CacheDir. It may be read-only when Offline is set
+	// and it holds every module the scaffolded project needs.
+	ModCache string
+	// Offline runs the go tool with GOPROXY=off and GOSUMDB=off, so modules
+	// only come from the module cache and generation never touches the network.
+	Offline bool
+
+	current Phase
+}
+
+// Generate runs the pipeline with a zero Generator.
+func Generate(ctx context.Context, request OperatorData, projectDir string) (*Result, error) {
+	var g Generator
+	return g.Generate(ctx, request, projectDir)
+}
+
+func (g *Generator) phase(p Phase) {
+	g.current = p
+	if g.OnPhase != nil {
+		g.OnPhase(p)
+	}
+}
+
+// Generate scaffolds the operator described by request into projectDir,
+// creating it if needed, and patches the generated sources. Commands are
+// killed when ctx is cancelled. Failed steps are reported as *Error.
+func (g *Generator) Generate(ctx context.Context, request OperatorData, projectDir string) (*Result, error) {
+	g.phase(PhaseScaffolding)
+	if err := os.MkdirAll(projectDir, 0o755); err != nil {
+		return nil, fmt.Errorf("create project dir %s: %w", projectDir, err)
+	}
+
+	log.Printf("Request parsed successfully: Domain=%s, Repo=%s, ProjectName=%s, CRDs=%d",
+		request.Domain, request.Repo, request.ProjectName, len(request.CRDs))
+	request.CRDs = ExpandVersions(request.CRDs)
+
+	needsMultiGroup := hasMultipleGroups(request.CRDs)
+	log.Printf("Multi-group layout needed: %v", needsMultiGroup)
+
+	cmdEnv := g.goEnv(projectDir)
+
+	log.Printf("Running operator-sdk init with domain=%s, repo=%s", request.Domain, request.Repo)
+	initArgs := []string{"init", "--domain", request.Domain, "--repo", request.Repo}
+	initCmd := exec.CommandContext(ctx, "operator-sdk", initArgs...)
+	initCmd.Dir = projectDir
+	initCmd.Env = cmdEnv
+
+	_, err := g.runCommand(StepInit, "", initCmd)
+	if err != nil {
+		log.Printf("operator-sdk init failed: %v", err)
+		return nil, stepError(err, "operator-sdk init failed")
+	}
+	log.Printf("operator-sdk init completed successfully")
+
+	// Enable multigroup layout if needed
+	if needsMultiGroup {
+		log.Printf("Enabling multigroup layout")
+		editCmd := exec.CommandContext(ctx, "operator-sdk", "edit", "--multigroup=true")
+		editCmd.Dir = projectDir
+		editCmd.Env = cmdEnv
+		_, editErr := g.runCommand(StepMultiGroup, "", editCmd)
+		if editErr != nil {
+			log.Printf("operator-sdk edit --multigroup=true failed: %v", editErr)
+			return nil, stepError(editErr, "Failed to enable multigroup layout")
+		}
+		log.Printf("Multigroup layout enabled successfully")
+	}
+
+	g.modTidy(ctx, projectDir, cmdEnv)
+	log.Printf("Go modules prepared successfully")
+
+	// Run operator-sdk create api for each CRD
+	log.Printf("Creating APIs for %d CRDs", len(request.CRDs))
+	for i, crd := range request.CRDs {
+		log.Printf("Creating API %d/%d: Group=%s, Version=%s, Kind=%s, Controller=%t",
+			i+1, len(request.CRDs), crd.Group, crd.Version, crd.Kind, crd.Controller)
+		if err := g.createAPI(ctx, projectDir, crd, cmdEnv); err != nil {
+			return nil, err
+		}
+		log.Printf("API created successfully for %s", crd.Kind)
+	}
+
+	g.phase(PhasePatching)
+
+	// Update Go type files with properties
+	log.Printf("Updating Go type files with properties")
+	var warnings []Warning
+	err = g.runStep(StepGoTypes, "", func() (err error) {
+		warnings, err = UpdateGoTypesDST(projectDir, request.CRDs)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error updating Go type files: %v", err)
+		return nil, stepError(err, "Failed to update Go type files")
+	}
+	for _, w := range warnings {
+		log.Printf("Warning: %s %s: %s", w.CRD, w.Field, w.Message)
+	}
+	log.Printf("Go type files updated successfully")
+
+	// Add RBAC markers to controller files
+	log.Printf("Adding RBAC markers to controller files")
+	if err := g.runStep(StepRBAC, "", func() error {
+		return UpdateControllerRBAC(projectDir, request.Domain, request.CRDs)
+	}); err != nil {
+		log.Printf("Error updating controller RBAC: %v", err)
+		return nil, stepError(err, "Failed to update controller RBAC")
+	}
+	log.Printf("Controller RBAC markers added successfully")
+
+	// Create webhooks for CRDs that have webhook configurations
+	log.Printf("Creating webhooks for CRDs")
+	webhooks, err := g.CreateWebhooks(ctx, projectDir, request.CRDs, cmdEnv)
+	if err != nil {
+		log.Printf("Error creating webhooks: %v", err)
+		return nil, stepError(err, "Failed to create webhooks")
+	}
+	log.Printf("Webhooks created successfully")
+
+	var conversionWarnings []Warning
+	if err := g.runStep(StepConversion, "", func() (err error) {
+		conversionWarnings, err = SetupConversions(projectDir, request.CRDs, needsMultiGroup)
+		return err
+	}); err != nil {
+		log.Printf("Error setting up conversions: %v", err)
+		return nil, stepError(err, "Failed to set up conversion between versions")
+	}
+	warnings = append(warnings, conversionWarnings...)
+
+	// Patch the generated main.go to set namespace scope
+	log.Printf("Patching main.go for namespace scope")
+	if err := g.runStep(StepMainScope, "", func() error {
+		return PatchMainNamespaceScopeDST(projectDir, request.Namespaces, request.WatchNamespaceEnv)
+	}); err != nil {
+		log.Printf("Error patching main.go: %v", err)
+		return nil, stepError(err, "Failed to patch main.go for namespace scope")
+	}
+	log.Printf("main.go patched successfully")
+
+	result := &Result{Dir: projectDir, MultiGroup: needsMultiGroup, Warnings: warnings, Webhooks: webhooks}
+
+	// Regenerate deepcopy code and render the manifests with controller-gen
+	if request.RenderManifests {
+		log.Printf("Rendering manifests with controller-gen")
+		manifests, manifestWarnings := g.RenderManifests(ctx, projectDir, request.CRDs, request.Domain, needsMultiGroup, cmdEnv)
+		result.Manifests = manifests
+		result.Warnings = append(result.Warnings, manifestWarnings...)
+		log.Printf("Rendered manifests for %d CRDs", len(manifests))
+	}
+	return result, nil
+}
+
+// goEnv returns the environment of the commands run for projectDir, with
+// writable Go caches inside projectDir unless they are shared between
+// generations.
+func (g *Generator) goEnv(projectDir string) []string {
+	cachesRoot := filepath.Join(projectDir, CacheDirName)
+	if g.CacheDir != "" {
+		cachesRoot = g.CacheDir
+	}
+	goCacheDir := filepath.Join(cachesRoot, "gocache")
+	goModCache := filepath.Join(cachesRoot, "pkg", "mod")
+	if g.ModCache != "" {
+		goModCache = g.ModCache
+	}
+	goPath := filepath.Join(cachesRoot, "gopath")
+	if err := os.MkdirAll(goCacheDir, 0o700); err != nil {
+		log.Printf("Warning: failed to create go cache dir %s: %v", goCacheDir, err)
+	}
+	if err := os.MkdirAll(goModCache, 0o700); err != nil {
+		log.Printf("Warning: failed to create go mod cache %s: %v", goModCache, err)
+	}
+	if err := os.MkdirAll(goPath, 0o700); err != nil {
+		log.Printf("Warning: failed to create GOPATH dir %s: %v", goPath, err)
+	}
+	log.Printf("Go env caches created under: %s", cachesRoot)
+
+	// keep the module cache writable so the caller can remove the project dir afterwards
+	goFlags := "-modcacherw"
+	cmdEnv := append(os.Environ(),
+		"GOCACHE="+goCacheDir,
+		"GOMODCACHE="+goModCache,
+		"GOPATH="+goPath,
+		"HOME="+projectDir,
+	)
+	if g.Offline {
+		// resolve everything from the module cache and let go.mod be updated
+		// from it, as nothing can be verified or downloaded
+		goFlags += " -mod=mod"
+		cmdEnv = append(cmdEnv, "GOPROXY=off", "GOSUMDB=off")
+		log.Printf("Generating offline with module cache %s", goModCache)
+	}
+	cmdEnv = append(cmdEnv, "GOFLAGS="+goFlags)
+
+	return cmdEnv
+}
+
+// modTidy runs go mod tidy in projectDir. A failure is only logged, as the
+// following steps may well succeed without it.
+func (g *Generator) modTidy(ctx context.Context, projectDir string, env []string) {
+	tidyCmd := exec.CommandContext(ctx, "go", "mod", "tidy")
+	tidyCmd.Dir = projectDir
+	tidyCmd.Env = env
+	if _, tidyErr := g.runCommand(StepModTidy, "", tidyCmd); tidyErr != nil {
+		log.Printf("Warning: go mod tidy failed: %v", tidyErr)
+	} else {
+		log.Printf("Ran go mod tidy successfully")
+	}
+}
+
+// createAPI runs operator-sdk create api for crd.
+func (g *Generator) createAPI(ctx context.Context, projectDir string, crd CRD, env []string) error {
+	args := []string{"create", "api", "--resource", "--group", crd.Group, "--version", crd.Version, "--kind", crd.Kind, "--make=false"}
+	if crd.Plural != "" {
+		// keep the CRD's resource name in line with the generated RBAC markers
+		args = append(args, "--plural", ResourceName(crd))
+	}
+	if crd.Controller {
+		args = append(args, "--controller")
+	} else {
+		args = append(args, "--controller=false")
+	}
+	apiCmd := exec.CommandContext(ctx, "operator-sdk", args...)
+	apiCmd.Dir = projectDir
+	apiCmd.Env = env
+	if _, err := g.runCommand(StepCreateAPI, crd.Kind, apiCmd); err != nil {
+		log.Printf("operator-sdk create api failed for %s: %v", crd.Kind, err)
+		return stepError(err, "operator-sdk create api failed for "+crd.Kind)
+	}
+	return nil
+}
+
+// WriteZip writes the generated project to w as a zip archive.
+func (r *Result) WriteZip(w io.Writer) error {
+	return ZipDir(r.Dir, w)
+}
+
+// ZipDir writes every file below srcDir to w as a zip archive, leaving out
+// the generator's caches and any previously written output.zip.
+func ZipDir(srcDir string, w io.Writer) error {
+	log.Printf("Starting to zip directory: %s", srcDir)
+	zipWriter := zip.NewWriter(w)
+	defer func() {
+		log.Println("Closing zip writer")
+		zipWriter.Close()
+	}()
+
+	err := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("Error accessing path %s: %v", path, err)
+			return err
+		}
+		log.Printf("Processing path: %s", path)
+
+		// Skip the output.zip file
+		if filepath.Base(path) == "output.zip" {
+			log.Printf("Skipping file: %s", path)
+			return nil
+		}
+
+		if d.IsDir() {
+			if d.Name() == CacheDirName {
+				log.Printf("Skipping cache directory: %s", path)
+				return filepath.SkipDir
+			}
+			log.Printf("Skipping directory: %s", path)
+			return nil
+		}
+		relPath, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			log.Printf("Error getting relative path for %s: %v", path, err)
+			return err
+		}
+		log.Printf("Relative path: %s", relPath)
+		f, err := zipWriter.Create(relPath)
+		if err != nil {
+			log.Printf("Error creating zip entry for %s: %v", relPath, err)
+			return err
+		}
+		srcFile, err := os.Open(path)
+		if err != nil {
+			log.Printf("Error opening file %s: %v", path, err)
+			return err
+		}
+		defer srcFile.Close()
+		_, err = io.Copy(f, srcFile)
+		if err != nil {
+			log.Printf("Error copying file %s to zip: %v", path, err)
+			return err
+		}
+		log.Printf("Successfully added %s to zip", path)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error walking directory %s: %v", srcDir, err)
+		return err
+	}
+	log.Println("Finished zipping directory")
+	return nil
+}
+
+// maxExtractedSize bounds the total size of the files ExtractZip writes.
+const maxExtractedSize = 512 << 20
+
+// ExtractZip writes the files of an uploaded project archive below dir.
+// Entries that would end up outside dir, symlinks and the generator's caches
+// are skipped; archives that expand to more than 512MiB are rejected.
+func ExtractZip(r *zip.Reader, dir string) error {
+	var written int64
+	for _, entry := range r.File {
+		name := filepath.FromSlash(entry.Name)
+		if !filepath.IsLocal(name) {
+			log.Printf("Skipping zip entry outside the project: %s", entry.Name)
+			continue
+		}
+		if entry.Mode()&fs.ModeSymlink != 0 {
+			log.Printf("Skipping symlink in zip: %s", entry.Name)
+			continue
+		}
+		if first, _, _ := strings.Cut(entry.Name, "/"); first == CacheDirName {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if entry.FileInfo().IsDir() {
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		n, err := extractZipFile(entry, path, maxExtractedSize-written)
+		if err != nil {
+			return fmt.Errorf("extract %s: %w", entry.Name, err)
+		}
+		written += n
+	}
+	return nil
+}
+
+// extractZipFile copies entry to path, failing when it is larger than limit.
+func extractZipFile(entry *zip.File, path string, limit int64) (int64, error) {
+	src, err := entry.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+	mode := fs.FileMode(0o644)
+	if entry.Mode()&0o111 != 0 {
+		mode = 0o755
+	}
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+	n, err := io.Copy(dst, io.LimitReader(src, limit+1))
+	if err != nil {
+		return n, err
+	}
+	if n > limit {
+		return n, errors.New("archive is too large")
+	}
+	return n, dst.Close()
+}
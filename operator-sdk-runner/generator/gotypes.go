@@ -0,0 +1,511 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/dave/dst/dstutil"
+)
+
+// UpdateGoTypesDST parses the generated *_types.go file with dave/dst,
+// finds the <Kind>Spec struct, then replaces the entire field list with
+// fields derived from the CRD.Properties slice. <Kind>Status is rewritten
+// the same way from CRD.StatusProperties when a status schema is given.
+// Validations that could not be applied are returned as warnings.
+func UpdateGoTypesDST(projectDir string, crds []CRD) ([]Warning, error) {
+	return updateGoTypes(projectDir, crds, hasMultipleGroups(crds))
+}
+
+// updateGoTypes is UpdateGoTypesDST for a project whose layout is already
+// known, as crds may be only some of the project's APIs.
+func updateGoTypes(projectDir string, crds []CRD, needsMultiGroup bool) ([]Warning, error) {
+	log.Printf("UpdateGoTypesDST: needsMultiGroup=%v", needsMultiGroup)
+
+	var warnings []Warning
+	for _, crd := range crds {
+		apiDir := filepath.Join(projectDir, apiPackagePath(crd, needsMultiGroup))
+		goFile := filepath.Join(apiDir, strings.ToLower(crd.Kind)+"_types.go")
+		log.Printf("UpdateGoTypesDST: Processing CRD %s.%s/%s, file path: %s", crd.Kind, crd.Group, crd.Version, goFile)
+
+		fset := token.NewFileSet()
+		file, err := decorator.ParseFile(fset, goFile, nil, parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s: %w", goFile, err)
+		}
+
+		// No enum type/const generation; only kubebuilder markers
+
+		specTypes := &structBuilder{crd: crd.Kind}
+		statusTypes := &structBuilder{crd: crd.Kind}
+		dstutil.Apply(file, func(c *dstutil.Cursor) bool {
+			genDecl, ok := c.Node().(*dst.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				return true
+			}
+			for _, spec := range genDecl.Specs {
+				ts, ok := spec.(*dst.TypeSpec)
+				if !ok {
+					continue
+				}
+				switch ts.Name.Name {
+				case crd.Kind:
+					// Handle the main Kind struct for CRD-level markers
+					if crd.Status && addTypeMarker(genDecl, "// +kubebuilder:subresource:status") {
+						log.Printf("Added status subresource marker to %s", crd.Kind)
+					}
+				case crd.Kind + "Spec":
+					// Handle the KindSpec struct for property validation markers
+					if st, ok := ts.Type.(*dst.StructType); ok {
+						st.Fields.List = specTypes.fields(crd.Kind+"Spec", "spec", crd.Properties)
+					}
+				case crd.Kind + "Status":
+					// Keep the scaffolded status unless a status schema was given
+					if len(crd.StatusProperties) == 0 && !crd.StatusConditions {
+						continue
+					}
+					if st, ok := ts.Type.(*dst.StructType); ok {
+						var fields []*dst.Field
+						if crd.StatusConditions {
+							fields = append(fields, conditionsStatusFields()...)
+						}
+						st.Fields.List = append(fields, statusTypes.fields(crd.Kind+"Status", "status", crd.StatusProperties)...)
+						log.Printf("Rewrote %sStatus with %d fields", crd.Kind, len(st.Fields.List))
+					}
+				}
+			}
+			return false
+		}, nil)
+		for _, b := range []*structBuilder{specTypes, statusTypes} {
+			if b.err != nil {
+				return nil, b.err
+			}
+		}
+		insertDeclsAfterType(file, crd.Kind+"Spec", specTypes.decls)
+		insertDeclsAfterType(file, crd.Kind+"Status", statusTypes.decls)
+		warnings = append(warnings, specTypes.warnings...)
+		warnings = append(warnings, statusTypes.warnings...)
+
+		var buf bytes.Buffer
+		if err := decorator.Fprint(&buf, file); err != nil {
+			return nil, fmt.Errorf("print %s: %w", goFile, err)
+		}
+		if err := os.WriteFile(goFile, buf.Bytes(), 0o644); err != nil {
+			return nil, fmt.Errorf("write %s: %w", goFile, err)
+		}
+		log.Printf("Updated Go type file (dst): %s", goFile)
+	}
+	return warnings, nil
+}
+
+// apiPackagePath returns the directory of a CRD's API package relative to the project.
+func apiPackagePath(crd CRD, multiGroup bool) string {
+	if multiGroup {
+		// Multi-group layout: api/<group>/<version>/
+		return filepath.Join("api", crd.Group, crd.Version)
+	}
+	// Single-group layout: api/<version>/
+	return filepath.Join("api", crd.Version)
+}
+
+// addTypeMarker adds marker to the doc comment of a type declaration, next to
+// its +kubebuilder:object:root marker when present. It reports whether the
+// marker was added, i.e. it was not already there.
+func addTypeMarker(genDecl *dst.GenDecl, marker string) bool {
+	pos := 0
+	for i, line := range genDecl.Decs.Start {
+		switch strings.TrimSpace(line) {
+		case marker:
+			return false
+		case "// +kubebuilder:object:root=true":
+			pos = i + 1
+		}
+	}
+	decs := append([]string{}, genDecl.Decs.Start[:pos]...)
+	decs = append(decs, marker)
+	genDecl.Decs.Start = append(decs, genDecl.Decs.Start[pos:]...)
+	return true
+}
+
+// conditionsStatusFields returns the standard observedGeneration and
+// conditions status fields.
+func conditionsStatusFields() []*dst.Field {
+	observedGeneration := &dst.Field{
+		Names: []*dst.Ident{dst.NewIdent("ObservedGeneration")},
+		Type:  dst.NewIdent("int64"),
+		Tag:   &dst.BasicLit{Kind: token.STRING, Value: "`json:\"observedGeneration,omitempty\"`"},
+	}
+	observedGeneration.Decs.Before = dst.NewLine
+	observedGeneration.Decs.Start.Append(
+		"// ObservedGeneration is the most recent generation observed by the controller.",
+		"// +optional",
+	)
+
+	conditions := &dst.Field{
+		Names: []*dst.Ident{dst.NewIdent("Conditions")},
+		Type:  &dst.ArrayType{Elt: &dst.SelectorExpr{X: dst.NewIdent("metav1"), Sel: dst.NewIdent("Condition")}},
+		Tag:   &dst.BasicLit{Kind: token.STRING, Value: "`json:\"conditions,omitempty\" patchStrategy:\"merge\" patchMergeKey:\"type\"`"},
+	}
+	conditions.Decs.Before = dst.NewLine
+	conditions.Decs.Start.Append(
+		"// Conditions represent the latest available observations of the resource's state.",
+		"// +listType=map",
+		"// +listMapKey=type",
+		"// +patchStrategy=merge",
+		"// +patchMergeKey=type",
+		"// +optional",
+	)
+	return []*dst.Field{observedGeneration, conditions}
+}
+
+// structBuilder converts properties into struct fields. Object properties
+// with child properties and array items become named struct types, which
+// are collected in decls so they can be added to the types file. Validations
+// that cannot be turned into markers are collected in warnings. Two
+// properties whose named types get the same name, e.g. fooBar and foo.bar,
+// are reported in err.
+type structBuilder struct {
+	crd      string
+	decls    []dst.Decl
+	warnings []Warning
+	// typePaths maps the declared types to the paths of their properties.
+	typePaths map[string]string
+	err       error
+}
+
+// fields returns the struct fields for props, which live at the JSON path
+// path. Named types needed by the fields are prefixed with typeName, e.g.
+// <Kind>SpecFoo for property foo.
+func (b *structBuilder) fields(typeName, path string, props []Property) []*dst.Field {
+	var fields []*dst.Field
+	for _, p := range props {
+		fieldPath := path + "." + p.Name
+		markers, unknown := buildKubebuilderMarkers(p)
+		b.warnUnknown(fieldPath, unknown)
+		if p.Type == "array" && p.Items != nil {
+			itemMarkers, unknown := buildItemsMarkers(*p.Items)
+			b.warnUnsupportedItems(fieldPath+"[]", unknown)
+			markers = append(markers, itemMarkers...)
+		}
+		tags := fmt.Sprintf("json:\"%s,omitempty\"", p.Name)
+		field := &dst.Field{
+			Names: []*dst.Ident{dst.NewIdent(ToCamelCase(p.Name))},
+			Type:  b.goType(typeName+ToCamelCase(p.Name), fieldPath, p),
+			Tag: &dst.BasicLit{
+				Kind:  token.STRING,
+				Value: fmt.Sprintf("`%s`", tags),
+			},
+		}
+		if len(markers) > 0 {
+			// markers must start on their own line above the field
+			field.Decs.Before = dst.NewLine
+			field.Decs.Start.Append(markers...)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// goType returns the Go type for p, declaring a struct called name when p is
+// an object with child properties. Array items of object type are declared
+// as name+"Item".
+func (b *structBuilder) goType(name, path string, p Property) dst.Expr {
+	switch {
+	case p.Type == "object" && len(p.Properties) > 0:
+		b.addStruct(name, path, p.Properties)
+		return dst.NewIdent(name)
+	case p.Type == "array" && p.Items != nil:
+		return &dst.ArrayType{Elt: b.goType(name+"Item", path+"[]", *p.Items)}
+	default:
+		return dst.NewIdent(GoTypeForProperty(p.Type))
+	}
+}
+
+// addStruct declares a struct type called name with fields for props.
+func (b *structBuilder) addStruct(name, path string, props []Property) {
+	if other, ok := b.typePaths[name]; ok {
+		if b.err == nil {
+			b.err = fmt.Errorf("%s: properties %s and %s both become the Go type %s; rename one of them", b.crd, other, path, name)
+		}
+		return
+	}
+	if b.typePaths == nil {
+		b.typePaths = map[string]string{}
+	}
+	b.typePaths[name] = path
+
+	// reserve the slot first so parents are declared before their children
+	idx := len(b.decls)
+	b.decls = append(b.decls, nil)
+
+	spec := &dst.TypeSpec{
+		Name: dst.NewIdent(name),
+		Type: &dst.StructType{Fields: &dst.FieldList{List: b.fields(name, path, props)}},
+	}
+	decl := &dst.GenDecl{Tok: token.TYPE, Specs: []dst.Spec{spec}}
+	decl.Decs.Before = dst.EmptyLine
+	decl.Decs.Start.Append(fmt.Sprintf("// %s defines a nested object of the custom resource.", name))
+	b.decls[idx] = decl
+}
+
+// warnUnknown records a warning for each validation type that has no marker.
+func (b *structBuilder) warnUnknown(path string, unknown []string) {
+	for _, t := range unknown {
+		b.warnings = append(b.warnings, Warning{
+			CRD:     b.crd,
+			Field:   path,
+			Message: fmt.Sprintf("unknown validation type %q was ignored", t),
+		})
+	}
+}
+
+// warnUnsupportedItems records a warning for each validation type of array
+// items that has no items: marker.
+func (b *structBuilder) warnUnsupportedItems(path string, unsupported []string) {
+	for _, t := range unsupported {
+		b.warnings = append(b.warnings, Warning{
+			CRD:     b.crd,
+			Field:   path,
+			Message: fmt.Sprintf("validation type %q is not supported on array items and was ignored", t),
+		})
+	}
+}
+
+// insertDeclsAfterType inserts decls right after the declaration of typeName,
+// or at the end of the file if typeName is not declared. Types of the same
+// name declared by an earlier run are replaced.
+func insertDeclsAfterType(file *dst.File, typeName string, decls []dst.Decl) {
+	if len(decls) == 0 {
+		return
+	}
+	removeTypeDecls(file, decls)
+	pos := len(file.Decls)
+	for i, decl := range file.Decls {
+		genDecl, ok := decl.(*dst.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			if ts, ok := spec.(*dst.TypeSpec); ok && ts.Name.Name == typeName {
+				pos = i + 1
+			}
+		}
+	}
+	rest := append([]dst.Decl{}, file.Decls[pos:]...)
+	file.Decls = append(append(file.Decls[:pos], decls...), rest...)
+}
+
+// removeTypeDecls removes the declarations of the types declared by decls
+// from file.
+func removeTypeDecls(file *dst.File, decls []dst.Decl) {
+	names := map[string]bool{}
+	for _, decl := range decls {
+		for _, spec := range decl.(*dst.GenDecl).Specs {
+			names[spec.(*dst.TypeSpec).Name.Name] = true
+		}
+	}
+	kept := file.Decls[:0]
+	for _, decl := range file.Decls {
+		if genDecl, ok := decl.(*dst.GenDecl); ok && genDecl.Tok == token.TYPE && len(genDecl.Specs) == 1 {
+			if ts, ok := genDecl.Specs[0].(*dst.TypeSpec); ok && names[ts.Name.Name] {
+				continue
+			}
+		}
+		kept = append(kept, decl)
+	}
+	file.Decls = kept
+}
+
+// buildItemsMarkers builds the item-level validation markers of an array
+// from the validations of its item schema. Validations without an items:
+// marker, including the items* types themselves and all validations of
+// object and array items, are returned in unknown.
+func buildItemsMarkers(items Property) (markers []string, unknown []string) {
+	if items.Type == "object" || items.Type == "array" {
+		for _, v := range items.Validations {
+			unknown = append(unknown, v.Type)
+		}
+		return nil, unknown
+	}
+	supported := items
+	supported.Validations = nil
+	for _, v := range items.Validations {
+		switch {
+		case strings.HasPrefix(v.Type, "items"), v.Type == "required", v.Type == "optional", v.Type == "default", v.Type == "example":
+			unknown = append(unknown, v.Type)
+		default:
+			supported.Validations = append(supported.Validations, v)
+		}
+	}
+	itemMarkers, more := buildKubebuilderMarkers(supported)
+	unknown = append(unknown, more...)
+	for _, m := range itemMarkers {
+		markers = append(markers, strings.Replace(m, "+kubebuilder:validation:", "+kubebuilder:validation:items:", 1))
+	}
+	return markers, unknown
+}
+
+// buildKubebuilderMarkers builds Kubebuilder CRD validation markers for a property.
+// Validation types without a marker are returned in unknown.
+func buildKubebuilderMarkers(p Property) (markers []string, unknown []string) {
+	for _, v := range p.Validations {
+		switch v.Type {
+		case "minLength":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:MinLength="+s)
+			}
+		case "maxLength":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:MaxLength="+s)
+			}
+		case "pattern":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:Pattern="+s)
+			}
+		case "minimum":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:Minimum="+s)
+			}
+		case "maximum":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:Maximum="+s)
+			}
+		case "multipleOf":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:MultipleOf="+s)
+			}
+		case "uniqueItems":
+			if b, ok := v.Value.(bool); ok && b {
+				markers = append(markers, "+kubebuilder:validation:UniqueItems=true")
+			}
+		case "minItems":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:MinItems="+s)
+			}
+		case "maxItems":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:MaxItems="+s)
+			}
+		case "minProperties":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:MinProperties="+s)
+			}
+		case "maxProperties":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:MaxProperties="+s)
+			}
+		case "format":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:Format="+s)
+			}
+		case "enum":
+			if vals := enumValues(v.Value); len(vals) > 0 {
+				markers = append(markers, "+kubebuilder:validation:Enum="+strings.Join(vals, ";"))
+			}
+		case "exclusiveMinimum":
+			if b, ok := v.Value.(bool); ok && b {
+				markers = append(markers, "+kubebuilder:validation:ExclusiveMinimum=true")
+			}
+		case "exclusiveMaximum":
+			if b, ok := v.Value.(bool); ok && b {
+				markers = append(markers, "+kubebuilder:validation:ExclusiveMaximum=true")
+			}
+		case "itemsPattern":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:items:Pattern="+s)
+			}
+		case "itemsFormat":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:items:Format="+s)
+			}
+		case "itemsEnum":
+			if vals := enumValues(v.Value); len(vals) > 0 {
+				markers = append(markers, "+kubebuilder:validation:items:Enum="+strings.Join(vals, ";"))
+			}
+		case "required":
+			markers = append(markers, "+kubebuilder:validation:Required")
+		case "optional":
+			markers = append(markers, "+kubebuilder:validation:Optional")
+		case "default":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:default:="+s)
+			}
+		case "example":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:example:="+s)
+			}
+		case "type":
+			if s, ok := v.Value.(string); ok && s != "" {
+				markers = append(markers, "+kubebuilder:validation:Type="+s)
+			}
+		default:
+			unknown = append(unknown, v.Type)
+		}
+	}
+	for i, m := range markers {
+		markers[i] = "// " + m
+	}
+	return markers, unknown
+}
+
+// enumValues returns the values of an enum validation, given either as a
+// JSON array or as the comma-separated string the frontend sends.
+func enumValues(value interface{}) []string {
+	var vals []string
+	switch v := value.(type) {
+	case []interface{}:
+		for _, val := range v {
+			if s, ok := val.(string); ok {
+				vals = append(vals, s)
+			}
+		}
+	case []string:
+		vals = v
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				vals = append(vals, s)
+			}
+		}
+	}
+	return vals
+}
+
+func GoTypeForProperty(openapiType string) string {
+	switch openapiType {
+	case "string":
+		return "string"
+	case "integer":
+		return "int"
+	case "number":
+		return "float64"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "[]interface{}" // Could be improved with more info
+	case "object":
+		return "map[string]interface{}"
+	default:
+		return "interface{}"
+	}
+}
+
+// ToCamelCase converts snake_case or kebab-case to CamelCase
+func ToCamelCase(s string) string {
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return r == '_' || r == '-'
+	})
+	for i, part := range parts {
+		if len(part) > 0 {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
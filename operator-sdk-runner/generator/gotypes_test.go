@@ -0,0 +1,235 @@
+package generator
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testTypesGo is an api/v1/foo_types.go as scaffolded by operator-sdk.
+const testTypesGo = `package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// FooSpec defines the desired state of Foo
+type FooSpec struct {
+	Foo string ` + "`json:\"foo,omitempty\"`" + `
+}
+
+// FooStatus defines the observed state of Foo
+type FooStatus struct {
+}
+
+// +kubebuilder:object:root=true
+
+// Foo is the Schema for the foos API
+type Foo struct {
+	metav1.TypeMeta   ` + "`json:\",inline\"`" + `
+	metav1.ObjectMeta ` + "`json:\"metadata,omitempty\"`" + `
+
+	Spec   FooSpec   ` + "`json:\"spec,omitempty\"`" + `
+	Status FooStatus ` + "`json:\"status,omitempty\"`" + `
+}
+`
+
+// runUpdateGoTypes writes testTypesGo into a project, updates it for crd and
+// returns the resulting file.
+func runUpdateGoTypes(t *testing.T, crd CRD) (string, []Warning, error) {
+	t.Helper()
+	dir := t.TempDir()
+	goFile := filepath.Join(dir, "api", "v1", "foo_types.go")
+	if err := os.MkdirAll(filepath.Dir(goFile), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(goFile, []byte(testTypesGo), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	warnings, err := updateGoTypes(dir, []CRD{crd}, false)
+	content, readErr := os.ReadFile(goFile)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	return string(content), warnings, err
+}
+
+func TestUpdateGoTypes(t *testing.T) {
+	object := func(name string, props ...Property) Property {
+		return Property{Name: name, Type: "object", Properties: props}
+	}
+	array := func(name string, items Property) Property {
+		return Property{Name: name, Type: "array", Items: &items}
+	}
+	str := Property{Name: "value", Type: "string"}
+
+	tests := []struct {
+		name       string
+		crd        CRD
+		want       []string
+		notWant    []string
+		wantErr    string
+		wantWarned []string
+	}{
+		{
+			name: "scalar fields with markers",
+			crd: CRD{Kind: "Foo", Version: "v1", Properties: []Property{
+				{Name: "size", Type: "integer", Validations: []Validation{{Type: "minimum", Value: "1"}}},
+				{Name: "image", Type: "string", Validations: []Validation{{Type: "pattern", Value: "^[a-z]+$"}}},
+			}},
+			want: []string{
+				"// +kubebuilder:validation:Minimum=1\n\tSize int `json:\"size,omitempty\"`",
+				"// +kubebuilder:validation:Pattern=^[a-z]+$\n\tImage string `json:\"image,omitempty\"`",
+			},
+			notWant: []string{"Foo string"},
+		},
+		{
+			name: "nested object",
+			crd:  CRD{Kind: "Foo", Version: "v1", Properties: []Property{object("database", str)}},
+			want: []string{"Database FooSpecDatabase `json:\"database,omitempty\"`", "type FooSpecDatabase struct"},
+		},
+		{
+			name: "array of objects",
+			crd:  CRD{Kind: "Foo", Version: "v1", Properties: []Property{array("ports", object("", str))}},
+			want: []string{"Ports []FooSpecPortsItem `json:\"ports,omitempty\"`", "type FooSpecPortsItem struct"},
+		},
+		{
+			name: "status properties",
+			crd:  CRD{Kind: "Foo", Version: "v1", StatusProperties: []Property{object("phase", str)}},
+			want: []string{"Phase FooStatusPhase `json:\"phase,omitempty\"`", "type FooStatusPhase struct"},
+		},
+		{
+			name: "unknown validation is warned about",
+			crd: CRD{Kind: "Foo", Version: "v1", Properties: []Property{
+				{Name: "size", Type: "integer", Validations: []Validation{{Type: "bogus", Value: "1"}}},
+			}},
+			wantWarned: []string{"spec.size"},
+		},
+		{
+			name: "array item markers",
+			crd: CRD{Kind: "Foo", Version: "v1", Properties: []Property{
+				{Name: "tags", Type: "array", Validations: []Validation{{Type: "itemsPattern", Value: "^[a-z]+$"}},
+					Items: &Property{Type: "string", Validations: []Validation{{Type: "maxLength", Value: "10"}, {Type: "default", Value: "x"}}}},
+			}},
+			want: []string{
+				"// +kubebuilder:validation:items:Pattern=^[a-z]+$\n\t// +kubebuilder:validation:items:MaxLength=10\n\tTags []string",
+			},
+			wantWarned: []string{"spec.tags[]"},
+		},
+		{
+			name: "validations on object items",
+			crd: CRD{Kind: "Foo", Version: "v1", Properties: []Property{
+				array("ports", Property{Type: "object", Properties: []Property{str}, Validations: []Validation{{Type: "minProperties", Value: "1"}}}),
+			}},
+			want:       []string{"Ports []FooSpecPortsItem"},
+			notWant:    []string{"MinProperties"},
+			wantWarned: []string{"spec.ports[]"},
+		},
+		{
+			name: "nested name collides with field name",
+			crd: CRD{Kind: "Foo", Version: "v1", Properties: []Property{
+				object("fooBar", str),
+				object("foo", object("bar", str)),
+			}},
+			wantErr: "properties spec.fooBar and spec.foo.bar both become the Go type FooSpecFooBar",
+		},
+		{
+			name: "array items collide with field name",
+			crd: CRD{Kind: "Foo", Version: "v1", Properties: []Property{
+				array("foo", object("", str)),
+				object("fooItem", str),
+			}},
+			wantErr: "properties spec.foo[] and spec.fooItem both become the Go type FooSpecFooItem",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, warnings, err := runUpdateGoTypes(t, tt.crd)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("updateGoTypes error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("updateGoTypes: %v", err)
+			}
+			if _, err := parser.ParseFile(token.NewFileSet(), "foo_types.go", content, 0); err != nil {
+				t.Errorf("updated file does not parse: %v\n%s", err, content)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(content, want) {
+					t.Errorf("updated file does not contain %q:\n%s", want, content)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(content, notWant) {
+					t.Errorf("updated file contains %q:\n%s", notWant, content)
+				}
+			}
+			var warned []string
+			for _, w := range warnings {
+				warned = append(warned, w.Field)
+			}
+			if strings.Join(warned, ",") != strings.Join(tt.wantWarned, ",") {
+				t.Errorf("warnings for %v, want %v", warned, tt.wantWarned)
+			}
+		})
+	}
+}
+
+func TestBuildItemsMarkers(t *testing.T) {
+	tests := []struct {
+		name        string
+		items       Property
+		wantMarkers []string
+		wantUnknown []string
+	}{
+		{
+			name:        "string items",
+			items:       Property{Type: "string", Validations: []Validation{{Type: "minLength", Value: "1"}, {Type: "format", Value: "email"}}},
+			wantMarkers: []string{"// +kubebuilder:validation:items:MinLength=1", "// +kubebuilder:validation:items:Format=email"},
+		},
+		{
+			name:        "enum items",
+			items:       Property{Type: "string", Validations: []Validation{{Type: "enum", Value: "a,b"}}},
+			wantMarkers: []string{"// +kubebuilder:validation:items:Enum=a;b"},
+		},
+		{
+			name:        "validations without an items marker",
+			items:       Property{Type: "integer", Validations: []Validation{{Type: "minimum", Value: "0"}, {Type: "required"}, {Type: "default", Value: "1"}, {Type: "itemsPattern", Value: "x"}}},
+			wantMarkers: []string{"// +kubebuilder:validation:items:Minimum=0"},
+			wantUnknown: []string{"required", "default", "itemsPattern"},
+		},
+		{
+			name:        "object items",
+			items:       Property{Type: "object", Validations: []Validation{{Type: "minProperties", Value: "1"}}},
+			wantUnknown: []string{"minProperties"},
+		},
+		{
+			name:        "array items",
+			items:       Property{Type: "array", Validations: []Validation{{Type: "uniqueItems", Value: true}}},
+			wantUnknown: []string{"uniqueItems"},
+		},
+		{
+			name:        "unknown validation",
+			items:       Property{Type: "string", Validations: []Validation{{Type: "bogus", Value: "1"}}},
+			wantUnknown: []string{"bogus"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markers, unknown := buildItemsMarkers(tt.items)
+			if !reflect.DeepEqual(markers, tt.wantMarkers) {
+				t.Errorf("markers = %q, want %q", markers, tt.wantMarkers)
+			}
+			if !reflect.DeepEqual(unknown, tt.wantUnknown) {
+				t.Errorf("unknown = %q, want %q", unknown, tt.wantUnknown)
+			}
+		})
+	}
+}
@@ -0,0 +1,757 @@
+package generator
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFile is the subset of the kubebuilder PROJECT file that maps onto
+// OperatorData.
+type ProjectFile struct {
+	Domain      string            `yaml:"domain"`
+	Repo        string            `yaml:"repo"`
+	ProjectName string            `yaml:"projectName"`
+	MultiGroup  bool              `yaml:"multigroup"`
+	Resources   []ProjectResource `yaml:"resources"`
+}
+
+// ProjectResource is one resource entry of the PROJECT file.
+type ProjectResource struct {
+	Group      string `yaml:"group"`
+	Version    string `yaml:"version"`
+	Kind       string `yaml:"kind"`
+	Plural     string `yaml:"plural"`
+	Path       string `yaml:"path"`
+	External   bool   `yaml:"external"`
+	Controller bool   `yaml:"controller"`
+	API        *struct {
+		Namespaced bool `yaml:"namespaced"`
+	} `yaml:"api"`
+	Webhooks *struct {
+		Defaulting bool `yaml:"defaulting"`
+		Validation bool `yaml:"validation"`
+		Conversion bool `yaml:"conversion"`
+	} `yaml:"webhooks"`
+}
+
+// ProjectImport is the OperatorData rebuilt from an existing project.
+type ProjectImport struct {
+	OperatorData OperatorData `json:"operatorData"`
+	// MultiGroup is set when the project uses the multi-group layout.
+	MultiGroup bool      `json:"multiGroup,omitempty"`
+	Warnings   []Warning `json:"warnings,omitempty"`
+}
+
+// validationMarkers maps +kubebuilder:validation markers with a value onto
+// validation types.
+var validationMarkers = map[string]string{
+	"MinLength":     "minLength",
+	"MaxLength":     "maxLength",
+	"Pattern":       "pattern",
+	"Minimum":       "minimum",
+	"Maximum":       "maximum",
+	"MultipleOf":    "multipleOf",
+	"MinItems":      "minItems",
+	"MaxItems":      "maxItems",
+	"MinProperties": "minProperties",
+	"MaxProperties": "maxProperties",
+	"Format":        "format",
+	"Type":          "type",
+}
+
+// flagMarkers maps boolean +kubebuilder:validation markers onto validation types.
+var flagMarkers = map[string]string{
+	"UniqueItems":      "uniqueItems",
+	"ExclusiveMinimum": "exclusiveMinimum",
+	"ExclusiveMaximum": "exclusiveMaximum",
+}
+
+// ProjectRoot returns the directory holding the PROJECT file: dir itself, or
+// its only subdirectory for archives that wrap the project in a folder.
+func ProjectRoot(dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, "PROJECT")); err == nil {
+		return dir, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var subdirs []string
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() != "__MACOSX" {
+			subdirs = append(subdirs, entry.Name())
+		}
+	}
+	if len(subdirs) == 1 {
+		root := filepath.Join(dir, subdirs[0])
+		if _, err := os.Stat(filepath.Join(root, "PROJECT")); err == nil {
+			return root, nil
+		}
+	}
+	return "", errors.New("no PROJECT file found, this is not a kubebuilder or operator-sdk project")
+}
+
+// ExtractProject extracts a project archive into dir, so that dir holds the
+// PROJECT file also when the archive wraps the project in a folder.
+func ExtractProject(r *zip.Reader, dir string) error {
+	if err := ExtractZip(r, dir); err != nil {
+		return err
+	}
+	root, err := ProjectRoot(dir)
+	if err != nil || root == dir {
+		return err
+	}
+	// move the folder aside first, the project may hold an entry of the same name
+	tmp, err := os.MkdirTemp(dir, ".project-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	wrapped := filepath.Join(tmp, "project")
+	if err := os.Rename(root, wrapped); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(wrapped)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.Rename(filepath.Join(wrapped, entry.Name()), filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadProjectFile reads the PROJECT file of the project in projectDir.
+func ReadProjectFile(projectDir string) (*ProjectFile, error) {
+	content, err := os.ReadFile(filepath.Join(projectDir, "PROJECT"))
+	if err != nil {
+		return nil, err
+	}
+	var project ProjectFile
+	if err := yaml.Unmarshal(content, &project); err != nil {
+		return nil, fmt.Errorf("parse PROJECT: %w", err)
+	}
+	return &project, nil
+}
+
+// ImportProject rebuilds the OperatorData of an existing operator-sdk project
+// from its PROJECT file, the Spec and Status types of its APIs, the RBAC
+// markers of its controllers, its webhook markers and the namespaces set up
+// in cmd/main.go. Code OperatorData cannot express is reported as warnings.
+func ImportProject(projectDir string) (*ProjectImport, error) {
+	project, err := ReadProjectFile(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("ImportProject: %s with %d resources", project.ProjectName, len(project.Resources))
+
+	imp := &projectImporter{dir: projectDir, project: project}
+	data := OperatorData{
+		Domain:      project.Domain,
+		Repo:        project.Repo,
+		ProjectName: project.ProjectName,
+		Namespaces:  []string{},
+		CRDs:        []CRD{},
+	}
+	for _, resource := range project.Resources {
+		if resource.API == nil || resource.External {
+			imp.warn(resource.Kind, "", fmt.Sprintf("%s/%s %s has no API in this project and was skipped", resource.Group, resource.Version, resource.Kind))
+			continue
+		}
+		crd, err := imp.crd(resource)
+		if err != nil {
+			return nil, err
+		}
+		data.CRDs = append(data.CRDs, crd)
+	}
+	data.Namespaces, data.WatchNamespaceEnv = imp.namespaces()
+	return &ProjectImport{OperatorData: data, MultiGroup: project.MultiGroup, Warnings: imp.warnings}, nil
+}
+
+type projectImporter struct {
+	dir      string
+	project  *ProjectFile
+	warnings []Warning
+
+	// types holds the type declarations of the API package being read.
+	types map[string]*dst.TypeSpec
+	// typeDecs holds the doc comments of those declarations.
+	typeDecs map[string]dst.Decorations
+}
+
+func (imp *projectImporter) warn(crd, field, message string) {
+	imp.warnings = append(imp.warnings, Warning{CRD: crd, Field: field, Message: message})
+}
+
+// packageDir returns the directory of the API package of resource.
+func (imp *projectImporter) packageDir(resource ProjectResource) string {
+	if rel, ok := strings.CutPrefix(resource.Path, imp.project.Repo+"/"); ok && resource.Path != "" {
+		return filepath.Join(imp.dir, filepath.FromSlash(rel))
+	}
+	crd := CRD{Group: resource.Group, Version: resource.Version}
+	return filepath.Join(imp.dir, apiPackagePath(crd, imp.project.MultiGroup))
+}
+
+// findFile returns the first of candidates, relative to the project, that exists.
+func (imp *projectImporter) findFile(candidates ...string) string {
+	for _, candidate := range candidates {
+		path := filepath.Join(imp.dir, candidate)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+func (imp *projectImporter) crd(resource ProjectResource) (CRD, error) {
+	crd := CRD{
+		Group:      resource.Group,
+		Version:    resource.Version,
+		Kind:       resource.Kind,
+		Plural:     resource.Plural,
+		Controller: resource.Controller,
+		RBAC:       []RBACPermission{},
+		Properties: []Property{},
+		Webhooks:   []WebhookConfig{},
+	}
+
+	if err := imp.loadTypes(imp.packageDir(resource)); err != nil {
+		return crd, err
+	}
+	if decs, ok := imp.typeDecs[crd.Kind]; ok {
+		for _, line := range decs {
+			if normalizeMarker(line) == "+kubebuilder:subresource:status" {
+				crd.Status = true
+			}
+		}
+	} else {
+		imp.warn(crd.Kind, "", fmt.Sprintf("type %s was not found in %s", crd.Kind, imp.packageDir(resource)))
+	}
+	if fields, ok := imp.structFields(crd.Kind + "Spec"); ok {
+		crd.Properties = imp.properties(crd.Kind, "spec", fields, map[string]bool{crd.Kind + "Spec": true})
+	}
+	if fields, ok := imp.structFields(crd.Kind + "Status"); ok {
+		crd.StatusConditions = hasConditionsField(fields)
+		if crd.StatusConditions {
+			// these are generated by statusConditions
+			fields = withoutFields(fields, "conditions", "observedGeneration")
+		}
+		crd.StatusProperties = imp.properties(crd.Kind, "status", fields, map[string]bool{crd.Kind + "Status": true})
+	}
+
+	if crd.Controller {
+		crd.RBAC = imp.rbac(crd)
+	}
+	if resource.Webhooks != nil {
+		crd.Webhooks = imp.webhooks(crd, resource)
+	}
+	return crd, nil
+}
+
+// loadTypes reads the type declarations of the Go package in dir.
+func (imp *projectImporter) loadTypes(dir string) error {
+	imp.types = map[string]*dst.TypeSpec{}
+	imp.typeDecs = map[string]dst.Decorations{}
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		name := filepath.Base(path)
+		if strings.HasSuffix(name, "_test.go") || strings.HasPrefix(name, "zz_generated") {
+			continue
+		}
+		file, err := decorator.ParseFile(token.NewFileSet(), path, nil, parser.ParseComments)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*dst.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				ts, ok := spec.(*dst.TypeSpec)
+				if !ok {
+					continue
+				}
+				imp.types[ts.Name.Name] = ts
+				// markers of an ungrouped declaration belong to the GenDecl
+				imp.typeDecs[ts.Name.Name] = append(append(dst.Decorations{}, genDecl.Decs.Start...), ts.Decs.Start...)
+			}
+		}
+	}
+	return nil
+}
+
+// structFields returns the fields of the struct type called name.
+func (imp *projectImporter) structFields(name string) ([]*dst.Field, bool) {
+	ts, ok := imp.types[name]
+	if !ok {
+		return nil, false
+	}
+	st, ok := ts.Type.(*dst.StructType)
+	if !ok || st.Fields == nil {
+		return nil, false
+	}
+	return st.Fields.List, true
+}
+
+// hasConditionsField reports whether a status struct has the standard
+// conditions list.
+func hasConditionsField(fields []*dst.Field) bool {
+	for _, field := range fields {
+		name, _ := jsonName(field)
+		if name != "conditions" {
+			continue
+		}
+		if array, ok := field.Type.(*dst.ArrayType); ok {
+			if sel, ok := array.Elt.(*dst.SelectorExpr); ok && sel.Sel.Name == "Condition" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withoutFields returns fields without the ones with the given JSON names.
+func withoutFields(fields []*dst.Field, names ...string) []*dst.Field {
+	var kept []*dst.Field
+	for _, field := range fields {
+		name, _ := jsonName(field)
+		if !contains(names, name) {
+			kept = append(kept, field)
+		}
+	}
+	return kept
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonName returns the JSON name of a struct field and whether it is inlined.
+func jsonName(field *dst.Field) (string, bool) {
+	if field.Tag == nil {
+		return "", false
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return "", false
+	}
+	name, options, _ := strings.Cut(reflect.StructTag(tag).Get("json"), ",")
+	return name, contains(strings.Split(options, ","), "inline")
+}
+
+// properties converts struct fields at the JSON path path into properties.
+// seen holds the named types being converted, to stop at recursive types.
+func (imp *projectImporter) properties(crd, path string, fields []*dst.Field, seen map[string]bool) []Property {
+	props := []Property{}
+	for _, field := range fields {
+		name, inline := jsonName(field)
+		switch {
+		case inline:
+			imp.warn(crd, path, "inlined fields are not supported and were skipped")
+			continue
+		case name == "-":
+			continue
+		case name == "":
+			if len(field.Names) == 0 {
+				imp.warn(crd, path, "embedded fields are not supported and were skipped")
+				continue
+			}
+			// encoding/json falls back to the Go field name
+			name = field.Names[0].Name
+		}
+		fieldPath := path + "." + name
+		prop := imp.property(crd, fieldPath, name, field.Type, seen)
+		imp.applyMarkers(crd, fieldPath, &prop, field.Decs.Start)
+		props = append(props, prop)
+	}
+	return props
+}
+
+// property converts the Go type expr of the property name into a Property.
+func (imp *projectImporter) property(crd, path, name string, expr dst.Expr, seen map[string]bool) Property {
+	prop := Property{Name: name, Validations: []Validation{}}
+	switch t := expr.(type) {
+	case *dst.StarExpr:
+		return imp.property(crd, path, name, t.X, seen)
+	case *dst.Ident:
+		if openapiType := basicOpenAPIType(t.Name); openapiType != "" {
+			prop.Type = openapiType
+			return prop
+		}
+		ts, ok := imp.types[t.Name]
+		if !ok {
+			prop.Type = "object"
+			imp.warn(crd, path, fmt.Sprintf("type %s was not found and is imported as an object", t.Name))
+			return prop
+		}
+		if seen[t.Name] {
+			prop.Type = "object"
+			imp.warn(crd, path, fmt.Sprintf("recursive type %s is imported as an object without properties", t.Name))
+			return prop
+		}
+		seen[t.Name] = true
+		defer delete(seen, t.Name)
+		if st, ok := ts.Type.(*dst.StructType); ok {
+			prop.Type = "object"
+			prop.Properties = imp.properties(crd, path, st.Fields.List, seen)
+		} else {
+			// a named type such as type Mode string, which may carry markers itself
+			prop = imp.property(crd, path, name, ts.Type, seen)
+		}
+		imp.applyMarkers(crd, path, &prop, imp.typeDecs[t.Name])
+	case *dst.ArrayType:
+		if ident, ok := t.Elt.(*dst.Ident); ok && ident.Name == "byte" {
+			prop.Type = "string"
+			prop.Validations = append(prop.Validations, Validation{Type: "format", Value: "byte"})
+			return prop
+		}
+		prop.Type = "array"
+		items := imp.property(crd, path+"[]", "", t.Elt, seen)
+		prop.Items = &items
+	case *dst.MapType:
+		prop.Type = "object"
+		imp.warn(crd, path, "map values are not supported, the property is imported as an object without properties")
+	case *dst.SelectorExpr:
+		pkg, _ := t.X.(*dst.Ident)
+		qualified := t.Sel.Name
+		if pkg != nil {
+			qualified = pkg.Name + "." + t.Sel.Name
+		}
+		switch t.Sel.Name {
+		case "Time", "MicroTime":
+			prop.Type = "string"
+			prop.Validations = append(prop.Validations, Validation{Type: "format", Value: "date-time"})
+		case "Duration":
+			prop.Type = "string"
+		case "Quantity", "IntOrString":
+			prop.Type = "string"
+			imp.warn(crd, path, fmt.Sprintf("%s is imported as a string", qualified))
+		default:
+			prop.Type = "object"
+			imp.warn(crd, path, fmt.Sprintf("%s from another package is imported as an object without properties", qualified))
+		}
+	default:
+		prop.Type = "object"
+		imp.warn(crd, path, "unsupported Go type, the property is imported as an object")
+	}
+	return prop
+}
+
+// basicOpenAPIType returns the OpenAPI type of a predeclared Go type.
+func basicOpenAPIType(name string) string {
+	switch name {
+	case "string":
+		return "string"
+	case "bool":
+		return "boolean"
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return "integer"
+	case "float32", "float64":
+		return "number"
+	}
+	return ""
+}
+
+// applyMarkers adds the validations of the kubebuilder markers in decs to
+// prop. Markers for array items are added to prop.Items.
+func (imp *projectImporter) applyMarkers(crd, path string, prop *Property, decs dst.Decorations) {
+	for _, line := range decs {
+		marker := normalizeMarker(line)
+		if !strings.HasPrefix(marker, "+") {
+			continue
+		}
+		target := prop
+		if rest, ok := strings.CutPrefix(marker, "+kubebuilder:validation:items:"); ok {
+			if prop.Items == nil {
+				imp.warn(crd, path, fmt.Sprintf("marker %s is only valid on arrays and was ignored", marker))
+				continue
+			}
+			target = prop.Items
+			marker = "+kubebuilder:validation:" + rest
+		}
+		if !addMarkerValidation(target, marker) {
+			imp.warn(crd, path, fmt.Sprintf("marker %s is not supported and was ignored", marker))
+		}
+	}
+}
+
+// addMarkerValidation adds the validation expressed by marker to prop. It
+// reports whether marker was understood; +optional needs no validation as
+// fields are optional unless marked required.
+func addMarkerValidation(prop *Property, marker string) bool {
+	add := func(validationType string, value interface{}) {
+		// a marker on the field wins over one on its type
+		for i, v := range prop.Validations {
+			if v.Type == validationType {
+				prop.Validations[i].Value = value
+				return
+			}
+		}
+		prop.Validations = append(prop.Validations, Validation{Type: validationType, Value: value})
+	}
+
+	switch marker {
+	case "+optional", "+kubebuilder:validation:Optional":
+		return true
+	case "+required", "+kubebuilder:validation:Required":
+		add("required", nil)
+		return true
+	}
+	for _, prefix := range []string{"+kubebuilder:default", "+kubebuilder:example"} {
+		if value, ok := strings.CutPrefix(marker, prefix); ok && (strings.HasPrefix(value, "=") || strings.HasPrefix(value, ":=")) {
+			add(strings.TrimPrefix(prefix, "+kubebuilder:"), strings.TrimPrefix(strings.TrimPrefix(value, ":"), "="))
+			return true
+		}
+	}
+
+	rest, ok := strings.CutPrefix(marker, "+kubebuilder:validation:")
+	if !ok {
+		return false
+	}
+	name, value, _ := strings.Cut(rest, "=")
+	if validationType, ok := validationMarkers[name]; ok {
+		add(validationType, value)
+		return true
+	}
+	if validationType, ok := flagMarkers[name]; ok {
+		if value == "" || value == "true" {
+			add(validationType, true)
+		}
+		return true
+	}
+	if name == "Enum" {
+		values := []interface{}{}
+		for _, v := range strings.Split(value, ";") {
+			values = append(values, strings.Trim(v, `"`))
+		}
+		add("enum", values)
+		return true
+	}
+	return false
+}
+
+// rbac returns the RBAC permissions of the controller of crd other than the
+// ones generateRBACMarkers adds for the CRD itself.
+func (imp *projectImporter) rbac(crd CRD) []RBACPermission {
+	file := strings.ToLower(crd.Kind) + "_controller.go"
+	path := imp.findFile(
+		filepath.Join("internal", "controller", crd.Group, file),
+		filepath.Join("internal", "controller", file),
+		filepath.Join("controllers", crd.Group, file),
+		filepath.Join("controllers", file),
+	)
+	permissions := []RBACPermission{}
+	if path == "" {
+		imp.warn(crd.Kind, "", "controller file was not found, RBAC permissions were not imported")
+		return permissions
+	}
+	controller, err := decorator.ParseFile(token.NewFileSet(), path, nil, parser.ParseComments)
+	if err != nil {
+		imp.warn(crd.Kind, "", fmt.Sprintf("parse %s: %v", path, err))
+		return permissions
+	}
+
+	group := fullGroup(crd.Group, imp.project.Domain)
+	resource := ResourceName(crd)
+	own := []string{resource, resource + "/status", resource + "/finalizers"}
+	for _, decl := range controller.Decls {
+		fn, ok := decl.(*dst.FuncDecl)
+		if !ok || fn.Name.Name != "Reconcile" {
+			continue
+		}
+		for _, line := range fn.Decs.Start {
+			rest, ok := strings.CutPrefix(normalizeMarker(line), "+kubebuilder:rbac:")
+			if !ok {
+				continue
+			}
+			args := parseMarkerArgs(rest)
+			groups, resources := markerArgValue(args, "groups"), markerArgValue(args, "resources")
+			if groups == group && contains(own, resources) {
+				continue
+			}
+			permission := RBACPermission{Group: groups, Resources: resources, Verbs: markerArgValue(args, "verbs")}
+			if permission.Group == `""` {
+				permission.Group = ""
+			}
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// webhooks returns the webhooks of crd listed in the PROJECT file, with the
+// settings of their +kubebuilder:webhook markers.
+func (imp *projectImporter) webhooks(crd CRD, resource ProjectResource) []WebhookConfig {
+	var webhooks []WebhookConfig
+	if resource.Webhooks.Defaulting {
+		webhooks = append(webhooks, WebhookConfig{Type: "mutating"})
+	}
+	if resource.Webhooks.Validation {
+		webhooks = append(webhooks, WebhookConfig{Type: "validating"})
+	}
+	if resource.Webhooks.Conversion {
+		webhooks = append(webhooks, WebhookConfig{Type: "conversion"})
+	}
+
+	file := strings.ToLower(crd.Kind) + "_webhook.go"
+	path := imp.findFile(
+		filepath.Join("internal", "webhook", crd.Group, crd.Version, file),
+		filepath.Join("internal", "webhook", crd.Version, file),
+		filepath.Join("api", crd.Group, crd.Version, file),
+		filepath.Join("api", crd.Version, file),
+	)
+	if path == "" {
+		if resource.Webhooks.Defaulting || resource.Webhooks.Validation {
+			imp.warn(crd.Kind, "", "webhook file was not found, webhook settings were not imported")
+		}
+		return webhooks
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		imp.warn(crd.Kind, "", fmt.Sprintf("read %s: %v", path, err))
+		return webhooks
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		rest, ok := strings.CutPrefix(normalizeMarker(line), "+kubebuilder:webhook:")
+		if !ok {
+			continue
+		}
+		args := parseMarkerArgs(rest)
+		webhookType := "validating"
+		if markerArgValue(args, "mutating") == "true" {
+			webhookType = "mutating"
+		}
+		for i := range webhooks {
+			if webhooks[i].Type == webhookType {
+				applyWebhookMarker(&webhooks[i], args)
+			}
+		}
+	}
+	return webhooks
+}
+
+// applyWebhookMarker copies the settings of a +kubebuilder:webhook marker to webhook.
+func applyWebhookMarker(webhook *WebhookConfig, args []markerArg) {
+	webhook.Path = markerArgValue(args, "path")
+	webhook.FailurePolicy = markerArgValue(args, "failurePolicy")
+	webhook.SideEffects = markerArgValue(args, "sideEffects")
+	webhook.MatchPolicy = markerArgValue(args, "matchPolicy")
+	if versions := markerArgValue(args, "admissionReviewVersions"); versions != "" {
+		webhook.AdmissionReviewVersions = strings.Split(versions, ";")
+	}
+	if verbs := markerArgValue(args, "verbs"); verbs != "" {
+		for _, verb := range strings.Split(verbs, ";") {
+			webhook.Operations = append(webhook.Operations, strings.ToUpper(verb))
+		}
+	}
+	if resources := markerArgValue(args, "resources"); resources != "" {
+		webhook.Resources = strings.Split(resources, ";")
+	}
+	if timeout, err := strconv.Atoi(markerArgValue(args, "timeoutSeconds")); err == nil {
+		webhook.TimeoutSeconds = timeout
+	}
+}
+
+// namespaces reads the namespaces the manager in cmd/main.go caches, the
+// reverse of PatchMainNamespaceScopeDST.
+func (imp *projectImporter) namespaces() ([]string, bool) {
+	namespaces := []string{}
+	mainPath := filepath.Join(imp.dir, "cmd", "main.go")
+	file, err := decorator.ParseFile(token.NewFileSet(), mainPath, nil, parser.ParseComments)
+	if err != nil {
+		imp.warn("", "namespaces", fmt.Sprintf("parse cmd/main.go: %v", err))
+		return namespaces, false
+	}
+
+	var defaultNamespaces dst.Expr
+	dst.Inspect(file, func(n dst.Node) bool {
+		kv, ok := n.(*dst.KeyValueExpr)
+		if !ok {
+			return true
+		}
+		if key, ok := kv.Key.(*dst.Ident); ok && key.Name == "DefaultNamespaces" {
+			defaultNamespaces = kv.Value
+			return false
+		}
+		return true
+	})
+
+	switch value := defaultNamespaces.(type) {
+	case *dst.CompositeLit:
+		for _, elt := range value.Elts {
+			if kv, ok := elt.(*dst.KeyValueExpr); ok {
+				if lit, ok := kv.Key.(*dst.BasicLit); ok && lit.Kind == token.STRING {
+					if ns, err := strconv.Unquote(lit.Value); err == nil {
+						namespaces = append(namespaces, ns)
+					}
+				}
+			}
+		}
+	case *dst.CallExpr:
+		if fn, ok := value.Fun.(*dst.Ident); ok && fn.Name == "watchNamespaces" {
+			return watchNamespacesFallback(file), true
+		}
+		imp.warn("", "namespaces", "the manager's DefaultNamespaces could not be read")
+	case nil:
+		// cluster-scoped
+	default:
+		imp.warn("", "namespaces", "the manager's DefaultNamespaces could not be read")
+	}
+	return namespaces, false
+}
+
+// watchNamespacesFallback returns the namespaces watchNamespaces uses when
+// WATCH_NAMESPACE is unset.
+func watchNamespacesFallback(file *dst.File) []string {
+	namespaces := []string{}
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*dst.FuncDecl)
+		if !ok || fn.Name.Name != "watchNamespaces" {
+			continue
+		}
+		dst.Inspect(fn, func(n dst.Node) bool {
+			assign, ok := n.(*dst.AssignStmt)
+			if !ok || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+				return true
+			}
+			if ident, ok := assign.Lhs[0].(*dst.Ident); !ok || ident.Name != "value" {
+				return true
+			}
+			if lit, ok := assign.Rhs[0].(*dst.BasicLit); ok && lit.Kind == token.STRING {
+				if value, err := strconv.Unquote(lit.Value); err == nil {
+					for _, ns := range strings.Split(value, ",") {
+						if ns = strings.TrimSpace(ns); ns != "" {
+							namespaces = append(namespaces, ns)
+						}
+					}
+				}
+			}
+			return false
+		})
+	}
+	return namespaces
+}
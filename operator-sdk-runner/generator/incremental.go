@@ -0,0 +1,212 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+)
+
+// incrementalPlan lists what GenerateIncremental changes in an existing project.
+type incrementalPlan struct {
+	// newAPIs are created with operator-sdk create api and patched like in
+	// a new project.
+	newAPIs []CRD
+	// changedTypes are existing APIs whose Spec or Status types differ.
+	changedTypes []CRD
+	// changedRBAC are existing controllers whose RBAC permissions differ.
+	changedRBAC []CRD
+	// newWebhooks are CRDs with only the webhooks the project lacks.
+	newWebhooks []CRD
+	// webhooks reports the requested webhooks the project already has.
+	webhooks []WebhookResult
+	warnings []Warning
+}
+
+// GenerateIncremental adds the APIs and webhooks of request that the existing
+// project in projectDir does not have yet, without running operator-sdk init.
+// The Go types and RBAC markers of existing APIs are only patched when request
+// changes them; APIs request does not mention, reconciler logic and any other
+// code are left alone. Failed steps are reported as *Error.
+func (g *Generator) GenerateIncremental(ctx context.Context, request OperatorData, projectDir string) (*Result, error) {
+	g.phase(PhaseScaffolding)
+	existing, err := ImportProject(projectDir)
+	if err != nil {
+		return nil, fmt.Errorf("read existing project: %w", err)
+	}
+	request.CRDs = ExpandVersions(request.CRDs)
+	plan, err := planIncremental(existing, request)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Incremental generation for %s: %d new APIs, %d changed types, %d changed controllers, %d CRDs with new webhooks",
+		existing.OperatorData.ProjectName, len(plan.newAPIs), len(plan.changedTypes), len(plan.changedRBAC), len(plan.newWebhooks))
+
+	domain := existing.OperatorData.Domain
+	cmdEnv := g.goEnv(projectDir)
+	if len(plan.newAPIs) > 0 {
+		g.modTidy(ctx, projectDir, cmdEnv)
+		for _, crd := range plan.newAPIs {
+			log.Printf("Creating API: Group=%s, Version=%s, Kind=%s, Controller=%t", crd.Group, crd.Version, crd.Kind, crd.Controller)
+			if err := g.createAPI(ctx, projectDir, crd, cmdEnv); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	g.phase(PhasePatching)
+
+	warnings := plan.warnings
+	if typeCRDs := append(append([]CRD{}, plan.newAPIs...), plan.changedTypes...); len(typeCRDs) > 0 {
+		var typeWarnings []Warning
+		err := g.runStep(StepGoTypes, "", func() (err error) {
+			typeWarnings, err = updateGoTypes(projectDir, typeCRDs, existing.MultiGroup)
+			return err
+		})
+		if err != nil {
+			log.Printf("Error updating Go type files: %v", err)
+			return nil, stepError(err, "Failed to update Go type files")
+		}
+		warnings = append(warnings, typeWarnings...)
+	}
+
+	if rbacCRDs := append(append([]CRD{}, plan.newAPIs...), plan.changedRBAC...); len(rbacCRDs) > 0 {
+		if err := g.runStep(StepRBAC, "", func() error {
+			return updateControllerRBAC(projectDir, domain, rbacCRDs, existing.MultiGroup)
+		}); err != nil {
+			log.Printf("Error updating controller RBAC: %v", err)
+			return nil, stepError(err, "Failed to update controller RBAC")
+		}
+	}
+
+	webhooks, err := g.CreateWebhooks(ctx, projectDir, plan.newWebhooks, cmdEnv)
+	if err != nil {
+		log.Printf("Error creating webhooks: %v", err)
+		var genErr *Error
+		if errors.As(err, &genErr) {
+			genErr.Webhooks = append(plan.webhooks, genErr.Webhooks...)
+		}
+		return nil, stepError(err, "Failed to create webhooks")
+	}
+
+	var conversionWarnings []Warning
+	if err := g.runStep(StepConversion, "", func() (err error) {
+		conversionWarnings, err = SetupConversions(projectDir, request.CRDs, existing.MultiGroup)
+		return err
+	}); err != nil {
+		log.Printf("Error setting up conversions: %v", err)
+		return nil, stepError(err, "Failed to set up conversion between versions")
+	}
+	warnings = append(warnings, conversionWarnings...)
+
+	for _, w := range warnings {
+		log.Printf("Warning: %s %s: %s", w.CRD, w.Field, w.Message)
+	}
+	result := &Result{Dir: projectDir, MultiGroup: existing.MultiGroup, Warnings: warnings, Webhooks: append(plan.webhooks, webhooks...)}
+	if request.RenderManifests {
+		log.Printf("Rendering manifests with controller-gen")
+		manifests, manifestWarnings := g.RenderManifests(ctx, projectDir, request.CRDs, domain, existing.MultiGroup, cmdEnv)
+		result.Manifests = manifests
+		result.Warnings = append(result.Warnings, manifestWarnings...)
+	}
+	return result, nil
+}
+
+// planIncremental compares request with the OperatorData read back from the
+// existing project.
+func planIncremental(existing *ProjectImport, request OperatorData) (*incrementalPlan, error) {
+	plan := &incrementalPlan{}
+	warn := func(crd, field, message string) {
+		plan.warnings = append(plan.warnings, Warning{CRD: crd, Field: field, Message: message})
+	}
+
+	current := existing.OperatorData
+	if request.Domain != "" && request.Domain != current.Domain {
+		warn("", "domain", fmt.Sprintf("the project's domain %q is kept, the domain of an existing project cannot be changed", current.Domain))
+	}
+	if request.Repo != "" && request.Repo != current.Repo {
+		warn("", "repo", fmt.Sprintf("the project's repo %q is kept, the repo of an existing project cannot be changed", current.Repo))
+	}
+	if !sameJSON(request.Namespaces, current.Namespaces) || request.WatchNamespaceEnv != current.WatchNamespaceEnv {
+		warn("", "namespaces", "cmd/main.go is not changed, the namespaces of an existing project are kept")
+	}
+
+	apis := map[string]CRD{}
+	groups := map[string]bool{}
+	for _, crd := range current.CRDs {
+		apis[crd.Group+"/"+crd.Version+"/"+crd.Kind] = crd
+		groups[crd.Group] = true
+	}
+	for _, crd := range request.CRDs {
+		old, ok := apis[crd.Group+"/"+crd.Version+"/"+crd.Kind]
+		if !ok {
+			plan.newAPIs = append(plan.newAPIs, crd)
+			if len(crd.Webhooks) > 0 {
+				plan.newWebhooks = append(plan.newWebhooks, crd)
+			}
+			groups[crd.Group] = true
+			continue
+		}
+
+		if crd.Controller != old.Controller || ResourceName(crd) != ResourceName(old) {
+			warn(crd.Kind, "", "the controller and plural of an existing API cannot be changed and were kept")
+		}
+		if crd.Status != old.Status || crd.StatusConditions != old.StatusConditions ||
+			!sameJSON(crd.Properties, old.Properties) || !sameJSON(crd.StatusProperties, old.StatusProperties) {
+			plan.changedTypes = append(plan.changedTypes, crd)
+		}
+		if old.Controller && !sameJSON(crd.RBAC, old.RBAC) {
+			changed := crd
+			changed.Controller, changed.Plural = true, old.Plural
+			plan.changedRBAC = append(plan.changedRBAC, changed)
+		}
+
+		have := map[string]bool{}
+		for _, webhook := range old.Webhooks {
+			have[webhook.Type] = true
+		}
+		added := crd
+		added.Webhooks = nil
+		for _, webhook := range crd.Webhooks {
+			switch {
+			case !have[webhook.Type]:
+				added.Webhooks = append(added.Webhooks, webhook)
+			case webhook.IsEnabled():
+				plan.webhooks = append(plan.webhooks, webhookResult(crd, webhook, WebhookSkipped, "the project already has this webhook"))
+			default:
+				plan.webhooks = append(plan.webhooks, webhookResult(crd, webhook, WebhookSkipped, "the webhook is not enabled, but the project already has it and it is not removed"))
+			}
+		}
+		if len(added.Webhooks) > 0 {
+			plan.newWebhooks = append(plan.newWebhooks, added)
+		}
+	}
+
+	if len(groups) > 1 && !existing.MultiGroup {
+		return nil, errors.New("the new APIs add a second group to a single-group project; migrate it to the multi-group layout with operator-sdk edit --multigroup=true first")
+	}
+	return plan, nil
+}
+
+// sameJSON reports whether a and b encode to equal JSON documents, with nil
+// and empty lists being equal.
+func sameJSON(a, b interface{}) bool {
+	return reflect.DeepEqual(decodedJSON(a), decodedJSON(b))
+}
+
+func decodedJSON(v interface{}) interface{} {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil
+	}
+	if list, ok := decoded.([]interface{}); ok && len(list) == 0 {
+		return nil
+	}
+	return decoded
+}
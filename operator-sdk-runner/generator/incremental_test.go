@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlanIncremental(t *testing.T) {
+	disabled := false
+	foo := CRD{Group: "apps", Version: "v1", Kind: "Foo", Controller: true,
+		Properties: []Property{{Name: "size", Type: "integer"}},
+		RBAC:       []RBACPermission{{Group: "", Resources: "pods", Verbs: "get"}},
+		Webhooks:   []WebhookConfig{{Type: "mutating"}}}
+	bar := CRD{Group: "apps", Version: "v1", Kind: "Bar", Webhooks: []WebhookConfig{{Type: "validating"}}}
+	existing := OperatorData{Domain: "example.com", Repo: "github.com/example/op", CRDs: []CRD{foo}}
+	with := func(crd CRD, change func(*CRD)) CRD {
+		change(&crd)
+		return crd
+	}
+
+	// kinds lists the Kinds of crds with the webhook types they carry
+	kinds := func(crds []CRD) []string {
+		var names []string
+		for _, crd := range crds {
+			name := crd.Kind
+			for _, webhook := range crd.Webhooks {
+				name += "+" + webhook.Type
+			}
+			names = append(names, name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		name         string
+		multiGroup   bool
+		request      OperatorData
+		newAPIs      []string
+		changedTypes []string
+		changedRBAC  []string
+		newWebhooks  []string
+		webhooks     []string // type:reason of the skipped webhooks
+		warnings     []string // the fields warned about
+		wantErr      bool
+	}{
+		{
+			name:     "unchanged",
+			request:  existing,
+			webhooks: []string{"mutating:the project already has this webhook"},
+		},
+		{
+			name:        "new API with a webhook",
+			request:     OperatorData{Domain: "example.com", Repo: "github.com/example/op", CRDs: []CRD{foo, bar}},
+			newAPIs:     []string{"Bar+validating"},
+			newWebhooks: []string{"Bar+validating"},
+			webhooks:    []string{"mutating:the project already has this webhook"},
+		},
+		{
+			name: "changed types and RBAC",
+			request: OperatorData{CRDs: []CRD{with(foo, func(crd *CRD) {
+				crd.Properties = append(crd.Properties, Property{Name: "image", Type: "string"})
+				crd.RBAC = append(crd.RBAC, RBACPermission{Group: "apps", Resources: "deployments", Verbs: "get"})
+			})}},
+			changedTypes: []string{"Foo+mutating"},
+			changedRBAC:  []string{"Foo+mutating"},
+			webhooks:     []string{"mutating:the project already has this webhook"},
+		},
+		{
+			name: "new webhook type on an existing API",
+			request: OperatorData{CRDs: []CRD{with(foo, func(crd *CRD) {
+				crd.Webhooks = []WebhookConfig{{Type: "mutating", Enabled: &disabled}, {Type: "validating"}}
+			})}},
+			newWebhooks: []string{"Foo+validating"},
+			webhooks:    []string{"mutating:the webhook is not enabled, but the project already has it and it is not removed"},
+		},
+		{
+			name: "project settings and controller are kept",
+			request: OperatorData{Domain: "example.org", Repo: "github.com/example/other", Namespaces: []string{"ns"},
+				CRDs: []CRD{with(foo, func(crd *CRD) { crd.Controller = false; crd.Webhooks = nil })}},
+			warnings: []string{"domain", "repo", "namespaces", "Foo"},
+		},
+		{
+			name:    "second group in a single-group project",
+			request: OperatorData{CRDs: []CRD{foo, with(bar, func(crd *CRD) { crd.Group = "batch" })}},
+			wantErr: true,
+		},
+		{
+			name:       "second group in a multi-group project",
+			multiGroup: true,
+			request:    OperatorData{CRDs: []CRD{foo, with(bar, func(crd *CRD) { crd.Group = "batch"; crd.Webhooks = nil })}},
+			newAPIs:    []string{"Bar"},
+			webhooks:   []string{"mutating:the project already has this webhook"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := planIncremental(&ProjectImport{OperatorData: existing, MultiGroup: tt.multiGroup}, tt.request)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("planIncremental error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var webhooks, warnings []string
+			for _, r := range plan.webhooks {
+				if r.Status != WebhookSkipped {
+					t.Errorf("webhook result %+v is not skipped", r)
+				}
+				webhooks = append(webhooks, r.Type+":"+r.Reason)
+			}
+			for _, w := range plan.warnings {
+				field := w.Field
+				if field == "" {
+					field = w.CRD
+				}
+				warnings = append(warnings, field)
+			}
+			for _, check := range []struct {
+				what      string
+				got, want []string
+			}{
+				{"new APIs", kinds(plan.newAPIs), tt.newAPIs},
+				{"changed types", kinds(plan.changedTypes), tt.changedTypes},
+				{"changed RBAC", kinds(plan.changedRBAC), tt.changedRBAC},
+				{"new webhooks", kinds(plan.newWebhooks), tt.newWebhooks},
+				{"webhook results", webhooks, tt.webhooks},
+				{"warnings", warnings, tt.warnings},
+			} {
+				if !reflect.DeepEqual(check.got, check.want) {
+					t.Errorf("%s = %q, want %q", check.what, check.got, check.want)
+				}
+			}
+		})
+	}
+}
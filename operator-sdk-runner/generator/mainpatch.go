@@ -0,0 +1,251 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/dave/dst/dstutil"
+)
+
+// watchNamespaceFuncTemplate is added to cmd/main.go when the namespaces are
+// read from the WATCH_NAMESPACE environment variable at runtime. The single
+// verb is the quoted, comma-separated list of namespaces used when it is unset.
+const watchNamespaceFuncTemplate = `package main
+
+// watchNamespaces returns the namespaces the manager caches, read from the
+// comma-separated WATCH_NAMESPACE environment variable. A nil map means all
+// namespaces are watched.
+func watchNamespaces() map[string]cache.Config {
+	value, ok := os.LookupEnv("WATCH_NAMESPACE")
+	if !ok {
+		value = %s
+	}
+	namespaces := map[string]cache.Config{}
+	for _, ns := range strings.Split(value, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces[ns] = cache.Config{}
+		}
+	}
+	if len(namespaces) == 0 {
+		return nil
+	}
+	return namespaces
+}
+`
+
+// PatchMainNamespaceScopeDST updates the generated cmd/main.go to set namespace scope using dave/dst.
+// When fromEnv is set, the namespaces are read from WATCH_NAMESPACE at runtime and
+// the given list is only used as the fallback.
+func PatchMainNamespaceScopeDST(projectDir string, namespaces []string, fromEnv bool) error {
+	mainPath := filepath.Join(projectDir, "cmd", "main.go")
+	fset := token.NewFileSet()
+	fileAst, err := decorator.ParseFile(fset, mainPath, nil, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("parse main.go: %w", err)
+	}
+	found, cacheWritten := false, false
+	dstutil.Apply(fileAst, func(c *dstutil.Cursor) bool {
+		cl, ok := c.Node().(*dst.CallExpr)
+		if !ok {
+			return true
+		}
+		// Look for ctrl.NewManager call
+		if sel, ok := cl.Fun.(*dst.SelectorExpr); ok && sel.Sel.Name == "NewManager" {
+			if len(cl.Args) == 2 {
+				if opts, ok := cl.Args[1].(*dst.CompositeLit); ok {
+					found = true
+					cacheFieldIdx := -1
+					for i, elt := range opts.Elts {
+						if kv, ok := elt.(*dst.KeyValueExpr); ok {
+							if ident, ok := kv.Key.(*dst.Ident); ok && ident.Name == "Cache" {
+								cacheFieldIdx = i
+								break
+							}
+						}
+					}
+					if len(namespaces) == 0 && !fromEnv {
+						// Remove Cache field if present (cluster-scoped)
+						if cacheFieldIdx >= 0 {
+							opts.Elts = append(opts.Elts[:cacheFieldIdx], opts.Elts[cacheFieldIdx+1:]...)
+						}
+					} else {
+						var defaultNamespaces dst.Expr
+						if fromEnv {
+							// Resolve Cache.DefaultNamespaces from WATCH_NAMESPACE at runtime
+							defaultNamespaces = &dst.CallExpr{Fun: dst.NewIdent("watchNamespaces")}
+						} else {
+							// Set Cache.DefaultNamespaces to provided list
+							mapElts := []dst.Expr{}
+							for _, ns := range namespaces {
+								mapElts = append(mapElts, &dst.KeyValueExpr{
+									Key:   &dst.BasicLit{Kind: token.STRING, Value: fmt.Sprintf("\"%s\"", ns)},
+									Value: &dst.CompositeLit{Type: &dst.SelectorExpr{X: dst.NewIdent("cache"), Sel: dst.NewIdent("Config")}},
+								})
+							}
+							defaultNamespaces = &dst.CompositeLit{
+								Type: &dst.MapType{
+									Key:   dst.NewIdent("string"),
+									Value: &dst.SelectorExpr{X: dst.NewIdent("cache"), Sel: dst.NewIdent("Config")},
+								},
+								Elts: mapElts,
+							}
+						}
+						cacheConfig := &dst.KeyValueExpr{
+							Key: dst.NewIdent("Cache"),
+							Value: &dst.CompositeLit{
+								Type: &dst.SelectorExpr{
+									X:   dst.NewIdent("cache"),
+									Sel: dst.NewIdent("Options"),
+								},
+								Elts: []dst.Expr{
+									&dst.KeyValueExpr{
+										Key:   dst.NewIdent("DefaultNamespaces"),
+										Value: defaultNamespaces,
+									},
+								},
+							},
+						}
+						if cacheFieldIdx >= 0 {
+							opts.Elts[cacheFieldIdx] = cacheConfig
+						} else {
+							opts.Elts = append(opts.Elts, cacheConfig)
+						}
+						cacheWritten = true
+					}
+				}
+			}
+		}
+		return true
+	}, nil)
+
+	if cacheWritten {
+		ensureImport(fileAst, cacheImport)
+	} else if !usesPackage(fileAst, "cache") {
+		removeImport(fileAst, cacheImport)
+	}
+
+	if found && fromEnv {
+		src := fmt.Sprintf(watchNamespaceFuncTemplate, strconv.Quote(strings.Join(namespaces, ",")))
+		funcFile, err := decorator.Parse(src)
+		if err != nil {
+			return fmt.Errorf("parse watchNamespaces template: %w", err)
+		}
+		fileAst.Decls = append(fileAst.Decls, funcFile.Decls...)
+		ensureImport(fileAst, "os")
+		ensureImport(fileAst, "strings")
+	}
+
+	if found {
+		var buf bytes.Buffer
+		if err := decorator.Fprint(&buf, fileAst); err != nil {
+			return fmt.Errorf("print main.go: %w", err)
+		}
+		if err := os.WriteFile(mainPath, buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("write main.go: %w", err)
+		}
+		log.Printf("Patched main.go for namespace scope (dst): %s", mainPath)
+	}
+	return nil
+}
+
+// cacheImport is the controller-runtime package of the manager's cache options.
+const cacheImport = "sigs.k8s.io/controller-runtime/pkg/cache"
+
+// usesPackage reports whether fileAst refers to a package imported as name.
+func usesPackage(fileAst *dst.File, name string) bool {
+	used := false
+	dst.Inspect(fileAst, func(n dst.Node) bool {
+		if sel, ok := n.(*dst.SelectorExpr); ok {
+			if ident, ok := sel.X.(*dst.Ident); ok && ident.Name == name && ident.Path == "" {
+				used = true
+			}
+		}
+		return !used
+	})
+	return used
+}
+
+// removeImport removes the unnamed import of path from fileAst, and the
+// import declaration if it becomes empty.
+func removeImport(fileAst *dst.File, path string) {
+	quoted := strconv.Quote(path)
+	var decls []dst.Decl
+	for _, decl := range fileAst.Decls {
+		genDecl, ok := decl.(*dst.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT {
+			decls = append(decls, decl)
+			continue
+		}
+		var specs []dst.Spec
+		for _, spec := range genDecl.Specs {
+			if importSpec, ok := spec.(*dst.ImportSpec); ok && importSpec.Path.Value == quoted && importSpec.Name == nil {
+				continue
+			}
+			specs = append(specs, spec)
+		}
+		genDecl.Specs = specs
+		if len(specs) > 0 {
+			decls = append(decls, genDecl)
+		}
+	}
+	fileAst.Decls = decls
+}
+
+// ensureImport adds path to the first import group of fileAst unless it is
+// already imported, creating the group if the file has none.
+func ensureImport(fileAst *dst.File, path string) {
+	quoted := strconv.Quote(path)
+	foundImport := false
+	dstutil.Apply(fileAst, func(c *dstutil.Cursor) bool {
+		genDecl, ok := c.Node().(*dst.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT {
+			return true
+		}
+		for _, spec := range genDecl.Specs {
+			importSpec, ok := spec.(*dst.ImportSpec)
+			if !ok {
+				continue
+			}
+			if importSpec.Path.Value == quoted {
+				foundImport = true
+				break
+			}
+		}
+		if !foundImport {
+			genDecl.Specs = append(genDecl.Specs, &dst.ImportSpec{
+				Path: &dst.BasicLit{
+					Kind:  token.STRING,
+					Value: quoted,
+				},
+			})
+			foundImport = true
+		}
+		return false
+	}, nil)
+
+	if !foundImport {
+		// If no import group exists, create a new one
+		fileAst.Decls = append([]dst.Decl{
+			&dst.GenDecl{
+				Tok: token.IMPORT,
+				Specs: []dst.Spec{
+					&dst.ImportSpec{
+						Path: &dst.BasicLit{
+							Kind:  token.STRING,
+							Value: quoted,
+						},
+					},
+				},
+			},
+		}, fileAst.Decls...)
+	}
+}
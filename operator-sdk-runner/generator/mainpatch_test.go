@@ -0,0 +1,166 @@
+package generator
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testMainGo is a cmd/main.go as scaffolded by operator-sdk, reduced to the
+// manager setup. %s is replaced by extra manager options.
+const testMainGo = `package main
+
+import (
+	"os"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+%s)
+
+func main() {
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+		LeaderElection: false,%s
+	})
+	if err != nil {
+		os.Exit(1)
+	}
+	_ = mgr
+}
+`
+
+// testControllerRuntime stubs the parts of controller-runtime cmd/main.go
+// uses, so the patched file can be built without network access.
+var testControllerRuntime = map[string]string{
+	"go.mod": "module sigs.k8s.io/controller-runtime\n\ngo 1.21\n",
+	"alias.go": `package controllerruntime
+
+import "sigs.k8s.io/controller-runtime/pkg/cache"
+
+type Config struct{}
+
+type Options struct {
+	LeaderElection bool
+	Cache          cache.Options
+}
+
+type Manager interface{}
+
+func GetConfigOrDie() *Config { return &Config{} }
+
+func NewManager(*Config, Options) (Manager, error) { return nil, nil }
+`,
+	"pkg/cache/cache.go": `package cache
+
+type Config struct{}
+
+type Options struct {
+	DefaultNamespaces map[string]Config
+}
+`,
+}
+
+// writeTestProject writes a project with the given cmd/main.go that builds
+// against the controller-runtime stub.
+func writeTestProject(t *testing.T, mainGo string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/project\n\ngo 1.21\n\n" +
+			"require sigs.k8s.io/controller-runtime v0.0.0\n\n" +
+			"replace sigs.k8s.io/controller-runtime => ./controller-runtime\n",
+		"cmd/main.go": mainGo,
+	}
+	for name, content := range testControllerRuntime {
+		files[filepath.Join("controller-runtime", name)] = content
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPatchMainNamespaceScopeDST(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+	const cacheImportLine = "\t\"sigs.k8s.io/controller-runtime/pkg/cache\"\n"
+	const cacheField = "\n\t\tCache: cache.Options{DefaultNamespaces: map[string]cache.Config{\"old\": {}}},"
+
+	tests := []struct {
+		name       string
+		imports    string
+		options    string
+		namespaces []string
+		fromEnv    bool
+		want       []string
+		notWant    []string
+	}{
+		{
+			name:    "cluster-scoped",
+			notWant: []string{"pkg/cache", "Cache:"},
+		},
+		{
+			name:    "cluster-scoped removes existing cache",
+			imports: cacheImportLine,
+			options: cacheField,
+			notWant: []string{"pkg/cache", "Cache:", `"old"`},
+		},
+		{
+			name:       "namespaces",
+			namespaces: []string{"team-a", "team-b"},
+			want:       []string{"pkg/cache", `"team-a": cache.Config{}`, `"team-b": cache.Config{}`},
+		},
+		{
+			name:       "namespaces replace existing cache",
+			imports:    cacheImportLine,
+			options:    cacheField,
+			namespaces: []string{"team-a"},
+			want:       []string{`"team-a": cache.Config{}`},
+			notWant:    []string{`"old"`},
+		},
+		{
+			name:       "from env",
+			namespaces: []string{"team-a"},
+			fromEnv:    true,
+			want:       []string{"pkg/cache", "DefaultNamespaces: watchNamespaces()", `value = "team-a"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTestProject(t, strings.Replace(strings.Replace(testMainGo, "%s", tt.imports, 1), "%s", tt.options, 1))
+
+			if err := PatchMainNamespaceScopeDST(dir, tt.namespaces, tt.fromEnv); err != nil {
+				t.Fatalf("PatchMainNamespaceScopeDST: %v", err)
+			}
+
+			content, err := os.ReadFile(filepath.Join(dir, "cmd", "main.go"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(string(content), want) {
+					t.Errorf("main.go does not contain %q:\n%s", want, content)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(string(content), notWant) {
+					t.Errorf("main.go contains %q:\n%s", notWant, content)
+				}
+			}
+
+			build := exec.Command("go", "build", "-o", os.DevNull, "./cmd")
+			build.Dir = dir
+			build.Env = append(os.Environ(), "GOPROXY=off", "GOFLAGS=-mod=mod", "GOWORK=off")
+			if out, err := build.CombinedOutput(); err != nil {
+				t.Errorf("patched main.go does not build: %v\n%s\n%s", err, out, content)
+			}
+		})
+	}
+}
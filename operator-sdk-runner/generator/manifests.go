@@ -0,0 +1,133 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Manifest is the rendered CustomResourceDefinition of one Kind, or the
+// reason it could not be rendered.
+type Manifest struct {
+	Group string `json:"group"`
+	// Version is the storage version of a multi-version Kind.
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// Path is the manifest's location relative to the project.
+	Path  string `json:"path,omitempty"`
+	YAML  string `json:"yaml,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// controllerGen returns the controller-gen binary baked into the runner
+// image, which can be overridden with the CONTROLLER_GEN env var.
+func controllerGen() string {
+	if bin := os.Getenv("CONTROLLER_GEN"); bin != "" {
+		return bin
+	}
+	return "controller-gen"
+}
+
+// RenderManifests runs what `make generate manifests` runs in the generated
+// project: deepcopy and CRD generation for every API package, then RBAC and
+// webhook manifests for the whole project. The API packages of crds are laid
+// out by multiGroup and their CRDs are named after domain, as in the project.
+// Packages holding versions of the same Kind are processed by one
+// controller-gen call, as it writes all versions of a Kind into one CRD, and
+// the other packages one by one, so a failure is reported on the CRDs of
+// those packages only. One Manifest is returned per Kind; RBAC and webhook
+// failures are returned as warnings.
+func (g *Generator) RenderManifests(ctx context.Context, projectDir string, crds []CRD, domain string, multiGroup bool, env []string) ([]Manifest, []Warning) {
+	crdDir := filepath.Join("config", "crd", "bases")
+
+	// join the packages of every Kind, each set named by its first package
+	var packages []string
+	set := map[string]string{}
+	kindPackage := map[string]string{}
+	var root func(pkg string) string
+	root = func(pkg string) string {
+		if set[pkg] != pkg {
+			set[pkg] = root(set[pkg])
+		}
+		return set[pkg]
+	}
+	for _, crd := range crds {
+		pkg := apiPackagePath(crd, multiGroup)
+		if _, seen := set[pkg]; !seen {
+			set[pkg] = pkg
+			packages = append(packages, pkg)
+		}
+		groupKind := crd.Group + "/" + crd.Kind
+		if other, ok := kindPackage[groupKind]; ok {
+			set[root(pkg)] = root(other)
+		} else {
+			kindPackage[groupKind] = pkg
+		}
+	}
+	var roots []string
+	paths := map[string][]string{}
+	for _, pkg := range packages {
+		r := root(pkg)
+		if _, ok := paths[r]; !ok {
+			roots = append(roots, r)
+		}
+		paths[r] = append(paths[r], "paths=./"+filepath.ToSlash(pkg)+"/...")
+	}
+
+	setErrors := map[string]string{}
+	for _, r := range roots {
+		args := append([]string{"object:headerFile=hack/boilerplate.go.txt", "crd"}, paths[r]...)
+		args = append(args, "output:crd:artifacts:config="+filepath.ToSlash(crdDir))
+		if err := g.runControllerGen(ctx, projectDir, env, args...); err != nil {
+			log.Printf("controller-gen failed for %s: %v", strings.Join(paths[r], " "), err)
+			setErrors[r] = fmt.Sprintf("controller-gen failed: %v", err)
+		}
+	}
+
+	var manifests []Manifest
+	rendered := map[string]bool{}
+	for _, crd := range crds {
+		groupKind := crd.Group + "/" + crd.Kind
+		if rendered[groupKind] {
+			continue
+		}
+		rendered[groupKind] = true
+
+		// a multi-version Kind is reported by its storage version
+		manifest := Manifest{Group: crd.Group, Version: StorageVersion(crd), Kind: crd.Kind}
+		if msg := setErrors[root(apiPackagePath(crd, multiGroup))]; msg != "" {
+			manifest.Error = msg
+			manifests = append(manifests, manifest)
+			continue
+		}
+		manifest.Path = filepath.ToSlash(filepath.Join(crdDir, fmt.Sprintf("%s_%s.yaml", fullGroup(crd.Group, domain), ResourceName(crd))))
+		content, err := os.ReadFile(filepath.Join(projectDir, manifest.Path))
+		if err != nil {
+			manifest.Error = fmt.Sprintf("rendered manifest not found: %v", err)
+			manifest.Path = ""
+		} else {
+			manifest.YAML = string(content)
+		}
+		manifests = append(manifests, manifest)
+	}
+
+	var warnings []Warning
+	if err := g.runControllerGen(ctx, projectDir, env, "rbac:roleName=manager-role", "webhook", "paths=./..."); err != nil {
+		log.Printf("controller-gen rbac/webhook failed: %v", err)
+		warnings = append(warnings, Warning{Message: fmt.Sprintf("RBAC and webhook manifests were not rendered: %v", err)})
+	}
+	return manifests, warnings
+}
+
+// runControllerGen runs controller-gen in projectDir. The error includes its output.
+func (g *Generator) runControllerGen(ctx context.Context, projectDir string, env []string, args ...string) error {
+	cmd := exec.CommandContext(ctx, controllerGen(), args...)
+	cmd.Dir = projectDir
+	cmd.Env = env
+	_, err := g.runCommand(StepControllerGen, "", cmd)
+	return err
+}
@@ -0,0 +1,137 @@
+package generator
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeControllerGen is a controller-gen that records its arguments and fails
+// when they contain FAKE_CG_FAIL.
+const fakeControllerGen = `#!/bin/sh
+echo "$@" >> "$FAKE_CG_ARGS"
+if [ -n "$FAKE_CG_FAIL" ]; then
+	case "$*" in *"$FAKE_CG_FAIL"*) echo "controller-gen failed" >&2; exit 1;; esac
+fi
+`
+
+func TestRenderManifests(t *testing.T) {
+	crdArgs := func(paths ...string) string {
+		return "object:headerFile=hack/boilerplate.go.txt crd " + strings.Join(paths, " ") + " output:crd:artifacts:config=config/crd/bases"
+	}
+	rbacArgs := "rbac:roleName=manager-role webhook paths=./..."
+	multiVersion := ExpandVersions([]CRD{{Group: "apps", Kind: "Foo", Versions: []CRDVersion{{Name: "v1"}, {Name: "v2", Storage: true}}}})
+
+	tests := []struct {
+		name       string
+		crds       []CRD
+		multiGroup bool
+		rendered   []string // manifests controller-gen writes
+		fail       string
+		wantCalls  []string
+		want       []string // kind/version: path or error of each manifest
+		wantWarned bool
+	}{
+		{
+			name:      "kinds of one package",
+			crds:      []CRD{{Group: "apps", Version: "v1", Kind: "Foo"}, {Group: "apps", Version: "v1", Kind: "Bar"}},
+			rendered:  []string{"apps.example.com_foos.yaml", "apps.example.com_bars.yaml"},
+			wantCalls: []string{crdArgs("paths=./api/v1/..."), rbacArgs},
+			want:      []string{"Foo/v1: config/crd/bases/apps.example.com_foos.yaml", "Bar/v1: config/crd/bases/apps.example.com_bars.yaml"},
+		},
+		{
+			name:      "versions of a kind in one call",
+			crds:      append(multiVersion, CRD{Group: "apps", Version: "v3", Kind: "Bar"}),
+			rendered:  []string{"apps.example.com_foos.yaml", "apps.example.com_bars.yaml"},
+			wantCalls: []string{crdArgs("paths=./api/v2/...", "paths=./api/v1/..."), crdArgs("paths=./api/v3/..."), rbacArgs},
+			want:      []string{"Foo/v2: config/crd/bases/apps.example.com_foos.yaml", "Bar/v3: config/crd/bases/apps.example.com_bars.yaml"},
+		},
+		{
+			name:       "multi-group layout",
+			crds:       []CRD{{Group: "apps", Version: "v1", Kind: "Foo"}, {Group: "batch", Version: "v1", Kind: "Bar", Plural: "Barries"}},
+			multiGroup: true,
+			rendered:   []string{"apps.example.com_foos.yaml", "batch.example.com_barries.yaml"},
+			wantCalls:  []string{crdArgs("paths=./api/apps/v1/..."), crdArgs("paths=./api/batch/v1/..."), rbacArgs},
+			want:       []string{"Foo/v1: config/crd/bases/apps.example.com_foos.yaml", "Bar/v1: config/crd/bases/batch.example.com_barries.yaml"},
+		},
+		{
+			name:      "failed package",
+			crds:      []CRD{{Group: "apps", Version: "v1", Kind: "Foo"}, {Group: "apps", Version: "v2", Kind: "Bar"}},
+			rendered:  []string{"apps.example.com_foos.yaml"},
+			fail:      "api/v2",
+			wantCalls: []string{crdArgs("paths=./api/v1/..."), crdArgs("paths=./api/v2/..."), rbacArgs},
+			want:      []string{"Foo/v1: config/crd/bases/apps.example.com_foos.yaml", "Bar/v2: controller-gen failed: exit status 1"},
+		},
+		{
+			name:      "manifest not rendered",
+			crds:      []CRD{{Group: "apps", Version: "v1", Kind: "Foo"}},
+			wantCalls: []string{crdArgs("paths=./api/v1/..."), rbacArgs},
+			want:      []string{"Foo/v1: rendered manifest not found"},
+		},
+		{
+			name:       "rbac and webhook manifests fail",
+			crds:       []CRD{{Group: "apps", Version: "v1", Kind: "Foo"}},
+			rendered:   []string{"apps.example.com_foos.yaml"},
+			fail:       "rbac",
+			wantCalls:  []string{crdArgs("paths=./api/v1/..."), rbacArgs},
+			want:       []string{"Foo/v1: config/crd/bases/apps.example.com_foos.yaml"},
+			wantWarned: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			projectDir := filepath.Join(tmp, "project")
+			crdDir := filepath.Join(projectDir, "config", "crd", "bases")
+			if err := os.MkdirAll(crdDir, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.rendered {
+				if err := os.WriteFile(filepath.Join(crdDir, name), []byte("kind: CustomResourceDefinition\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			bin := filepath.Join(tmp, "controller-gen")
+			if err := os.WriteFile(bin, []byte(fakeControllerGen), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("CONTROLLER_GEN", bin)
+			argsFile := filepath.Join(tmp, "args")
+			env := append(os.Environ(), "FAKE_CG_ARGS="+argsFile, "FAKE_CG_FAIL="+tt.fail)
+
+			manifests, warnings := (&Generator{}).RenderManifests(context.Background(), projectDir, tt.crds, "example.com", tt.multiGroup, env)
+
+			content, err := os.ReadFile(argsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if calls := strings.Split(strings.TrimSpace(string(content)), "\n"); !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("controller-gen calls = %q\nwant %q", calls, tt.wantCalls)
+			}
+			var got []string
+			for _, m := range manifests {
+				result := m.Path
+				if m.Error != "" {
+					result = m.Error
+				} else if m.YAML == "" {
+					t.Errorf("manifest of %s has no YAML", m.Kind)
+				}
+				got = append(got, m.Kind+"/"+m.Version+": "+result)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("manifests = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if !strings.HasPrefix(got[i], tt.want[i]) {
+					t.Errorf("manifest %d = %q, want %q", i, got[i], tt.want[i])
+				}
+			}
+			if (len(warnings) > 0) != tt.wantWarned {
+				t.Errorf("warnings = %+v, want warned %v", warnings, tt.wantWarned)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package generator
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// maxPreviewContentSize is the largest file whose content is included in a preview.
+const maxPreviewContentSize = 1 << 20
+
+// File is a generated file as listed in a preview.
+type File struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Content is only set for text files up to maxPreviewContentSize.
+	Content string `json:"content,omitempty"`
+	Binary  bool   `json:"binary,omitempty"`
+}
+
+// Preview lists the files of a generated project together with the generation report.
+type Preview struct {
+	*Result
+	Files []File `json:"files"`
+}
+
+// Preview lists every file of the generated project, leaving out the same
+// files as WriteZip.
+func (r *Result) Preview() (*Preview, error) {
+	files, err := ListFiles(r.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Preview{Result: r, Files: files}, nil
+}
+
+// ListFiles returns the files below dir with slash-separated relative paths.
+// Text file contents are included; binary and oversized files are only listed.
+func ListFiles(dir string) ([]File, error) {
+	var files []File
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == CacheDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() == "output.zip" {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		file := File{Path: filepath.ToSlash(relPath), Size: info.Size()}
+		if info.Size() <= maxPreviewContentSize {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if isText(content) {
+				file.Content = string(content)
+			} else {
+				file.Binary = true
+			}
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// isText reports whether content looks like UTF-8 text.
+func isText(content []byte) bool {
+	return utf8.Valid(content) && !bytes.ContainsRune(content, 0)
+}
@@ -0,0 +1,206 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+	"github.com/dave/dst/dstutil"
+)
+
+// UpdateControllerRBAC adds RBAC markers to controller files based on user selections
+func UpdateControllerRBAC(projectDir, domain string, crds []CRD) error {
+	return updateControllerRBAC(projectDir, domain, crds, hasMultipleGroups(crds))
+}
+
+// updateControllerRBAC is UpdateControllerRBAC for a project whose layout is
+// already known.
+func updateControllerRBAC(projectDir, domain string, crds []CRD, needsMultiGroup bool) error {
+	log.Printf("UpdateControllerRBAC: needsMultiGroup=%v", needsMultiGroup)
+
+	for _, crd := range crds {
+		if !crd.Controller {
+			continue // Skip if no controller requested
+		}
+
+		var controllerDir string
+		if needsMultiGroup {
+			// Multi-group layout: internal/controller/<group>/
+			controllerDir = filepath.Join(projectDir, "internal", "controller", crd.Group)
+		} else {
+			// Single-group layout: internal/controller/
+			controllerDir = filepath.Join(projectDir, "internal", "controller")
+		}
+
+		controllerFile := filepath.Join(controllerDir, strings.ToLower(crd.Kind)+"_controller.go")
+		log.Printf("UpdateControllerRBAC: Processing controller file: %s", controllerFile)
+
+		if _, err := os.Stat(controllerFile); os.IsNotExist(err) {
+			log.Printf("Controller file does not exist, skipping: %s", controllerFile)
+			continue
+		}
+
+		fset := token.NewFileSet()
+		file, err := decorator.ParseFile(fset, controllerFile, nil, parser.ParseComments)
+		if err != nil {
+			return fmt.Errorf("parse controller file %s: %w", controllerFile, err)
+		}
+
+		// Generate RBAC markers based on user selections
+		rbacMarkers := generateRBACMarkers(crd, domain)
+
+		if len(rbacMarkers) == 0 {
+			continue // No RBAC permissions selected
+		}
+
+		// Find the Reconcile function and add RBAC markers above it
+		dstutil.Apply(file, func(c *dstutil.Cursor) bool {
+			fn, ok := c.Node().(*dst.FuncDecl)
+			if !ok || fn.Name.Name != "Reconcile" {
+				return true
+			}
+
+			// Add RBAC markers before the Reconcile function, replacing the
+			// markers operator-sdk scaffolded for the CRD itself
+			fn.Decs.Start = replaceRBACMarkers(fn.Decs.Start, fullGroup(crd.Group, domain), rbacMarkers)
+			log.Printf("Added %d RBAC markers to Reconcile function in %s", len(rbacMarkers), controllerFile)
+			return false
+		}, nil)
+
+		// Write the updated file
+		var buf bytes.Buffer
+		if err := decorator.Fprint(&buf, file); err != nil {
+			return fmt.Errorf("print controller file %s: %w", controllerFile, err)
+		}
+		if err := os.WriteFile(controllerFile, buf.Bytes(), 0o644); err != nil {
+			return fmt.Errorf("write controller file %s: %w", controllerFile, err)
+		}
+		log.Printf("Updated controller file with RBAC markers: %s", controllerFile)
+	}
+	return nil
+}
+
+// generateRBACMarkers creates kubebuilder RBAC markers based on user selections
+func generateRBACMarkers(crd CRD, domain string) []string {
+	var markers []string
+
+	// Always add permissions for the CRD itself
+	group := fullGroup(crd.Group, domain)
+	resource := ResourceName(crd)
+	markers = append(markers, fmt.Sprintf("// +kubebuilder:rbac:groups=%s,resources=%s,verbs=get;list;watch;create;update;patch;delete", group, resource))
+	if crd.Status {
+		markers = append(markers, fmt.Sprintf("// +kubebuilder:rbac:groups=%s,resources=%s/status,verbs=get;update;patch", group, resource))
+	}
+	// Setting an owner reference with blockOwnerDeletion on a dependent object
+	// needs update on the owner's finalizers, so only grant it to controllers
+	// that create other objects.
+	if createsObjects(crd.RBAC) {
+		markers = append(markers, fmt.Sprintf("// +kubebuilder:rbac:groups=%s,resources=%s/finalizers,verbs=update", group, resource))
+	}
+
+	// Add user-defined RBAC permissions
+	for _, permission := range crd.RBAC {
+		if permission.Group != "" || permission.Resources != "" || permission.Verbs != "" {
+			group := permission.Group
+			if group == "" {
+				group = `""`
+			}
+			markers = append(markers, fmt.Sprintf("// +kubebuilder:rbac:groups=%s,resources=%s,verbs=%s", group, permission.Resources, permission.Verbs))
+		}
+	}
+
+	return markers
+}
+
+// createsObjects reports whether any permission grants the create verb.
+func createsObjects(rbac []RBACPermission) bool {
+	for _, permission := range rbac {
+		for _, verb := range strings.Split(permission.Verbs, ";") {
+			if v := strings.TrimSpace(verb); v == "create" || v == "*" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// replaceRBACMarkers removes the existing RBAC markers for group from decs and
+// inserts markers in their place, or at the top when there were none.
+// Markers that are already present elsewhere in decs are not repeated.
+func replaceRBACMarkers(decs dst.Decorations, group string, markers []string) dst.Decorations {
+	pos := -1
+	existing := map[string]bool{}
+	var kept []string
+	for _, line := range decs {
+		marker := normalizeMarker(line)
+		if strings.HasPrefix(marker, "+kubebuilder:rbac:") {
+			if pos < 0 {
+				pos = len(kept)
+			}
+			if strings.Contains(marker, "groups="+group+",") {
+				continue
+			}
+			existing[marker] = true
+		}
+		kept = append(kept, line)
+	}
+	if pos < 0 {
+		pos = 0
+	}
+
+	var added []string
+	for _, m := range markers {
+		if !existing[normalizeMarker(m)] {
+			added = append(added, m)
+		}
+	}
+	result := append([]string{}, kept[:pos]...)
+	result = append(result, added...)
+	return append(result, kept[pos:]...)
+}
+
+// normalizeMarker strips the comment prefix so "//+marker" and "// +marker"
+// compare equal.
+func normalizeMarker(line string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "//"))
+}
+
+// fullGroup returns the API group of a CRD, i.e. <group>.<domain>.
+func fullGroup(group, domain string) string {
+	if domain == "" {
+		return group
+	}
+	return group + "." + domain
+}
+
+// ResourceName returns the lowercase plural resource name of a CRD, taken
+// from CRD.Plural or derived from the Kind.
+func ResourceName(crd CRD) string {
+	if crd.Plural != "" {
+		return strings.ToLower(crd.Plural)
+	}
+	return Pluralize(strings.ToLower(crd.Kind))
+}
+
+// Pluralize returns the English plural of a lowercase noun, following the
+// basic rules kubebuilder applies to Kinds.
+func Pluralize(singular string) string {
+	switch {
+	case singular == "":
+		return ""
+	case strings.HasSuffix(singular, "s"), strings.HasSuffix(singular, "x"), strings.HasSuffix(singular, "z"),
+		strings.HasSuffix(singular, "ch"), strings.HasSuffix(singular, "sh"):
+		return singular + "es"
+	case strings.HasSuffix(singular, "y") && len(singular) > 1 && !strings.ContainsRune("aeiou", rune(singular[len(singular)-2])):
+		return singular[:len(singular)-1] + "ies"
+	default:
+		return singular + "s"
+	}
+}
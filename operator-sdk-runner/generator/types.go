@@ -0,0 +1,89 @@
+package generator
+
+type Validation struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type Property struct {
+	Name        string       `json:"name"`
+	Type        string       `json:"type"`
+	Validations []Validation `json:"validations"`
+	Properties  []Property   `json:"properties,omitempty" validate:"dive"` // child properties when Type is "object"
+	Items       *Property    `json:"items,omitempty" validate:"omitempty"` // item schema when Type is "array"
+}
+
+type RBACPermission struct {
+	Group     string `json:"group"`
+	Resources string `json:"resources"`
+	Verbs     string `json:"verbs"`
+	Preset    string `json:"preset,omitempty"`
+}
+
+type WebhookConfig struct {
+	Type                    string         `json:"type"`                              // "mutating", "validating", or "conversion"
+	AdmissionReviewVersions []string       `json:"admissionReviewVersions,omitempty"` // v1, v1beta1
+	FailurePolicy           string         `json:"failurePolicy,omitempty"`           // "Fail" or "Ignore"
+	SideEffects             string         `json:"sideEffects,omitempty"`             // "None", "NoneOnDryRun", "Some", "Unknown"
+	MatchPolicy             string         `json:"matchPolicy,omitempty"`             // "Exact" or "Equivalent"
+	Path                    string         `json:"path,omitempty"`                    // webhook path (e.g., "/mutate-v1-pod")
+	Operations              []string       `json:"operations,omitempty"`              // "CREATE", "UPDATE", "DELETE"
+	Resources               []string       `json:"resources,omitempty"`               // resources to watch
+	TimeoutSeconds          int            `json:"timeoutSeconds,omitempty"`          // 1 to 30, the API server's default is 10
+	NamespaceSelector       *LabelSelector `json:"namespaceSelector,omitempty"`       // namespaces whose objects are sent to the webhook
+	ObjectSelector          *LabelSelector `json:"objectSelector,omitempty"`          // labels of the objects sent to the webhook
+	Enabled                 *bool          `json:"enabled,omitempty"`                 // unset means enabled
+}
+
+// IsEnabled reports whether the webhook is scaffolded, which it is unless
+// Enabled is explicitly false.
+func (w WebhookConfig) IsEnabled() bool {
+	return w.Enabled == nil || *w.Enabled
+}
+
+// LabelSelector selects objects by their labels like a Kubernetes
+// metav1.LabelSelector.
+type LabelSelector struct {
+	MatchLabels      map[string]string          `json:"matchLabels,omitempty" yaml:"matchLabels,omitempty"`
+	MatchExpressions []LabelSelectorRequirement `json:"matchExpressions,omitempty" yaml:"matchExpressions,omitempty"`
+}
+
+type LabelSelectorRequirement struct {
+	Key      string   `json:"key" yaml:"key"`
+	Operator string   `json:"operator" yaml:"operator"` // "In", "NotIn", "Exists" or "DoesNotExist"
+	Values   []string `json:"values,omitempty" yaml:"values,omitempty"`
+}
+
+type CRD struct {
+	Group            string           `json:"group" validate:"required,alphanum|alphanumunicode"`
+	Version          string           `json:"version" validate:"required_without=Versions,omitempty,alphanum|alphanumunicode"`
+	Kind             string           `json:"kind" validate:"required,alphanum|alphanumunicode"`
+	Plural           string           `json:"plural" validate:"omitempty,alphanum|alphanumunicode"`
+	Controller       bool             `json:"controller"`
+	Status           bool             `json:"status"`
+	StatusProperties []Property       `json:"statusProperties,omitempty" validate:"dive,required"`
+	StatusConditions bool             `json:"statusConditions,omitempty"` // adds Conditions and ObservedGeneration to the status
+	RBAC             []RBACPermission `json:"rbac"`
+	Properties       []Property       `json:"properties" validate:"dive,required"`
+	Webhooks         []WebhookConfig  `json:"webhooks,omitempty"`
+	Versions         []CRDVersion     `json:"versions,omitempty" validate:"dive"` // every version of a Kind served in several versions, instead of Version
+}
+
+// CRDVersion is one version of a Kind served in several versions. Versions
+// other than the storage version are converted to and from it.
+type CRDVersion struct {
+	Name             string     `json:"name" validate:"required,alphanum|alphanumunicode"`
+	Storage          bool       `json:"storage,omitempty"`                                   // the storage version and conversion hub
+	Properties       []Property `json:"properties,omitempty" validate:"dive,required"`       // defaults to the CRD's properties
+	StatusProperties []Property `json:"statusProperties,omitempty" validate:"dive,required"` // defaults to the CRD's statusProperties
+}
+
+type OperatorData struct {
+	Domain            string   `json:"domain" validate:"required,hostname_rfc1123"`
+	Repo              string   `json:"repo" validate:"required"`
+	ProjectName       string   `json:"projectName" validate:"required,alphanum|alphanumunicode"`
+	Namespaces        []string `json:"namespaces" validate:"dive,hostname_rfc1123"` // empty means cluster-scoped
+	WatchNamespaceEnv bool     `json:"watchNamespaceEnv,omitempty"`                 // read namespaces from WATCH_NAMESPACE at runtime, Namespaces is the fallback
+	CRDs              []CRD    `json:"crds" validate:"required,dive,required"`
+	RenderManifests   bool     `json:"renderManifests,omitempty"` // run controller-gen for deepcopy code and manifests
+}
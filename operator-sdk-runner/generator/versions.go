@@ -0,0 +1,146 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dave/dst"
+	"github.com/dave/dst/decorator"
+)
+
+// ExpandVersions returns crds with every multi-version CRD replaced by one CRD
+// per version, storage version first, so that the rest of the pipeline only
+// deals with single versions. The storage version, the hub, keeps the
+// controller, the admission webhooks and a conversion webhook; the other
+// versions, the spokes, only get their types. Expanded CRDs keep Versions so
+// that StorageVersion still finds the hub.
+func ExpandVersions(crds []CRD) []CRD {
+	var expanded []CRD
+	for _, crd := range crds {
+		if len(crd.Versions) == 0 {
+			expanded = append(expanded, crd)
+			continue
+		}
+
+		hub := StorageVersion(crd)
+		versions := []CRDVersion{}
+		for _, version := range crd.Versions {
+			if version.Name == hub {
+				versions = append([]CRDVersion{version}, versions...)
+			} else {
+				versions = append(versions, version)
+			}
+		}
+		for _, version := range versions {
+			v := crd
+			v.Version = version.Name
+			if version.Properties != nil {
+				v.Properties = version.Properties
+			}
+			if version.StatusProperties != nil {
+				v.StatusProperties = version.StatusProperties
+			}
+			if version.Name != hub {
+				v.Controller = false
+				v.Webhooks = nil
+			} else if len(crd.Versions) > 1 {
+				v.Webhooks = withConversionWebhook(crd.Webhooks)
+			}
+			expanded = append(expanded, v)
+		}
+	}
+	return expanded
+}
+
+// withConversionWebhook adds a conversion webhook to webhooks unless
+// one is configured already.
+func withConversionWebhook(webhooks []WebhookConfig) []WebhookConfig {
+	for _, webhook := range webhooks {
+		if webhook.Type == "conversion" {
+			return webhooks
+		}
+	}
+	return append(append([]WebhookConfig{}, webhooks...), WebhookConfig{Type: "conversion"})
+}
+
+// StorageVersion returns the version of a multi-version CRD flagged as
+// storage version, or its first version if none is.
+func StorageVersion(crd CRD) string {
+	for _, version := range crd.Versions {
+		if version.Storage {
+			return version.Name
+		}
+	}
+	if len(crd.Versions) > 0 {
+		return crd.Versions[0].Name
+	}
+	return crd.Version
+}
+
+// SetupConversions finishes the conversion between the versions of the
+// expanded multi-version CRDs among crds: the hub's Kind is marked with
+// +kubebuilder:storageversion. Its Hub method and the spokes' ConvertTo and
+// ConvertFrom functions are scaffolded by CreateWebhooks, which passes the
+// spokes to operator-sdk; a spoke without them is reported as a warning.
+func SetupConversions(projectDir string, crds []CRD, multiGroup bool) ([]Warning, error) {
+	var warnings []Warning
+	for _, crd := range crds {
+		if len(crd.Versions) < 2 {
+			continue
+		}
+		apiDir := filepath.Join(projectDir, apiPackagePath(crd, multiGroup))
+		if crd.Version == StorageVersion(crd) {
+			typesFile := filepath.Join(apiDir, strings.ToLower(crd.Kind)+"_types.go")
+			if err := markStorageVersion(typesFile, crd.Kind); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		conversionFile := filepath.Join(apiDir, strings.ToLower(crd.Kind)+"_conversion.go")
+		if _, err := os.Stat(conversionFile); err != nil {
+			log.Printf("No conversion for %s %s: %s", crd.Kind, crd.Version, conversionFile)
+			warnings = append(warnings, Warning{CRD: crd.Kind, Field: "versions",
+				Message: fmt.Sprintf("version %s has no ConvertTo and ConvertFrom functions; add them, e.g. with operator-sdk create webhook --conversion --spoke %s --force on the storage version", crd.Version, crd.Version)})
+		}
+	}
+	return warnings, nil
+}
+
+// markStorageVersion adds +kubebuilder:storageversion to the Kind in goFile.
+func markStorageVersion(goFile, kind string) error {
+	file, err := decorator.ParseFile(token.NewFileSet(), goFile, nil, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("parse %s: %w", goFile, err)
+	}
+	added := false
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*dst.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			if ts, ok := spec.(*dst.TypeSpec); ok && ts.Name.Name == kind {
+				added = addTypeMarker(genDecl, "// +kubebuilder:storageversion")
+			}
+		}
+	}
+	if !added {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := decorator.Fprint(&buf, file); err != nil {
+		return fmt.Errorf("print %s: %w", goFile, err)
+	}
+	if err := os.WriteFile(goFile, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", goFile, err)
+	}
+	log.Printf("Marked %s as storage version in: %s", kind, goFile)
+	return nil
+}
@@ -0,0 +1,127 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandVersions(t *testing.T) {
+	spec := []Property{{Name: "size", Type: "integer"}}
+	v1Spec := []Property{{Name: "replicas", Type: "integer"}}
+	mutating := WebhookConfig{Type: "mutating"}
+	conversion := WebhookConfig{Type: "conversion"}
+
+	tests := []struct {
+		name string
+		crd  CRD
+		want []CRD
+	}{
+		{
+			name: "single version",
+			crd:  CRD{Group: "apps", Version: "v1", Kind: "Foo", Controller: true, Webhooks: []WebhookConfig{mutating}},
+			want: []CRD{{Group: "apps", Version: "v1", Kind: "Foo", Controller: true, Webhooks: []WebhookConfig{mutating}}},
+		},
+		{
+			name: "one entry in versions",
+			crd:  CRD{Group: "apps", Kind: "Foo", Controller: true, Versions: []CRDVersion{{Name: "v1"}}},
+			want: []CRD{{Group: "apps", Version: "v1", Kind: "Foo", Controller: true, Versions: []CRDVersion{{Name: "v1"}}}},
+		},
+		{
+			name: "storage version first with a conversion webhook",
+			crd: CRD{Group: "apps", Kind: "Foo", Controller: true, Properties: spec, Webhooks: []WebhookConfig{mutating},
+				Versions: []CRDVersion{{Name: "v1", Properties: v1Spec}, {Name: "v2", Storage: true}}},
+			want: []CRD{
+				{Group: "apps", Version: "v2", Kind: "Foo", Controller: true, Properties: spec, Webhooks: []WebhookConfig{mutating, conversion},
+					Versions: []CRDVersion{{Name: "v1", Properties: v1Spec}, {Name: "v2", Storage: true}}},
+				{Group: "apps", Version: "v1", Kind: "Foo", Properties: v1Spec,
+					Versions: []CRDVersion{{Name: "v1", Properties: v1Spec}, {Name: "v2", Storage: true}}},
+			},
+		},
+		{
+			name: "configured conversion webhook is kept",
+			crd: CRD{Group: "apps", Kind: "Foo", Webhooks: []WebhookConfig{conversion},
+				Versions: []CRDVersion{{Name: "v1"}, {Name: "v2"}}},
+			want: []CRD{
+				{Group: "apps", Version: "v1", Kind: "Foo", Webhooks: []WebhookConfig{conversion}, Versions: []CRDVersion{{Name: "v1"}, {Name: "v2"}}},
+				{Group: "apps", Version: "v2", Kind: "Foo", Versions: []CRDVersion{{Name: "v1"}, {Name: "v2"}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExpandVersions([]CRD{tt.crd}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandVersions() = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStorageVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		crd  CRD
+		want string
+	}{
+		{"single version", CRD{Version: "v1"}, "v1"},
+		{"flagged storage version", CRD{Versions: []CRDVersion{{Name: "v1"}, {Name: "v2", Storage: true}}}, "v2"},
+		{"first version by default", CRD{Versions: []CRDVersion{{Name: "v1beta1"}, {Name: "v1"}}}, "v1beta1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StorageVersion(tt.crd); got != tt.want {
+				t.Errorf("StorageVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetupConversions(t *testing.T) {
+	dir := t.TempDir()
+	for _, version := range []string{"v1", "v2"} {
+		apiDir := filepath.Join(dir, "api", version)
+		if err := os.MkdirAll(apiDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(apiDir, "foo_types.go"), []byte(strings.ReplaceAll(testTypesGo, "package v1", "package "+version)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	crds := ExpandVersions([]CRD{{Group: "apps", Kind: "Foo", Versions: []CRDVersion{{Name: "v1"}, {Name: "v2", Storage: true}}}})
+
+	warnings, err := SetupConversions(dir, crds, false)
+	if err != nil {
+		t.Fatalf("SetupConversions: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].CRD != "Foo" || !strings.Contains(warnings[0].Message, "version v1 has no ConvertTo") {
+		t.Errorf("warnings = %+v, want one about the missing v1 conversion", warnings)
+	}
+	for version, want := range map[string]bool{"v1": false, "v2": true} {
+		content, err := os.ReadFile(filepath.Join(dir, "api", version, "foo_types.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		marked := strings.Contains(string(content), "// +kubebuilder:storageversion\n")
+		if marked != want {
+			t.Errorf("%s marked as storage version = %v, want %v", version, marked, want)
+		}
+	}
+
+	// the conversion functions of the spoke silence the warning, and the
+	// storage version is marked once
+	if err := os.WriteFile(filepath.Join(dir, "api", "v1", "foo_conversion.go"), []byte("package v1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if warnings, err := SetupConversions(dir, crds, false); err != nil || len(warnings) != 0 {
+		t.Errorf("SetupConversions() = %+v, %v, want no warnings", warnings, err)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "api", "v2", "foo_types.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(content), "+kubebuilder:storageversion"); n != 1 {
+		t.Errorf("storage version marked %d times, want once", n)
+	}
+}
@@ -0,0 +1,426 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// webhookFlags maps webhook types to the operator-sdk create webhook flags
+// that scaffold them.
+var webhookFlags = map[string]string{
+	"mutating":   "--defaulting",
+	"validating": "--programmatic-validation",
+	"conversion": "--conversion",
+}
+
+// Webhook result statuses.
+const (
+	WebhookCreated = "created"
+	WebhookSkipped = "skipped"
+	WebhookFailed  = "failed"
+)
+
+// WebhookResult reports what happened to one configured webhook.
+type WebhookResult struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	Type    string `json:"type"`
+	// Status is WebhookCreated, WebhookSkipped or WebhookFailed.
+	Status string `json:"status"`
+	// Reason explains why the webhook was skipped or failed.
+	Reason string `json:"reason,omitempty"`
+}
+
+func webhookResult(crd CRD, webhook WebhookConfig, status, reason string) WebhookResult {
+	return WebhookResult{Group: crd.Group, Version: crd.Version, Kind: crd.Kind, Type: webhook.Type, Status: status, Reason: reason}
+}
+
+// CreateWebhooks creates the enabled admission webhooks of crds and reports
+// the outcome of every configured webhook. All webhooks of a CRD are
+// scaffolded by a single operator-sdk call, as operator-sdk refuses to write a
+// Kind's webhook file twice. Unknown webhook types, conflicts and failed calls
+// are returned as *Error, which carries the results so far in its Webhooks.
+func (g *Generator) CreateWebhooks(ctx context.Context, projectDir string, crds []CRD, env []string) (results []WebhookResult, err error) {
+	defer func() {
+		var genErr *Error
+		if errors.As(err, &genErr) {
+			genErr.Webhooks = results
+		}
+	}()
+	for _, crd := range crds {
+		var enabled []WebhookConfig
+		for _, webhook := range crd.Webhooks {
+			if !webhook.IsEnabled() {
+				log.Printf("Skipping disabled %s webhook of %s", webhook.Type, crd.Kind)
+				results = append(results, webhookResult(crd, webhook, WebhookSkipped, "the webhook is not enabled"))
+				continue
+			}
+			enabled = append(enabled, webhook)
+		}
+		if len(enabled) == 0 {
+			continue
+		}
+
+		reject := func(message, details, hint string) error {
+			g.emit(Event{Step: StepCreateWebhook, Phase: g.current, CRD: crd.Kind, Error: details, StartedAt: time.Now()})
+			return &Error{Message: message, Details: details, Step: StepCreateWebhook, CRD: crd.Kind, Hint: hint}
+		}
+
+		var types []string
+		flags := map[string]bool{}
+		for _, webhook := range enabled {
+			flag, ok := webhookFlags[webhook.Type]
+			if !ok {
+				return results, reject("Unknown webhook type", fmt.Sprintf("%s has a webhook of unknown type %q", crd.Kind, webhook.Type),
+					"Webhook types are mutating, validating and conversion.")
+			}
+			if flags[flag] {
+				return results, reject("Conflicting webhooks", fmt.Sprintf("%s has more than one %s webhook", crd.Kind, webhook.Type), "")
+			}
+			flags[flag] = true
+			types = append(types, webhook.Type)
+		}
+		file := webhookFile(projectDir, crd)
+		if _, err := os.Stat(file); err == nil {
+			rel, _ := filepath.Rel(projectDir, file)
+			return results, reject("Conflicting webhooks", fmt.Sprintf("%s already exists; operator-sdk cannot add the %s webhooks to it without overwriting it", rel, strings.Join(types, " and ")),
+				"Run operator-sdk create webhook --force on the project and merge the previous webhook code back, or generate the project from scratch.")
+		}
+
+		log.Printf("Creating webhooks for %s.%s (types: %s)", crd.Kind, crd.Group, strings.Join(types, ", "))
+
+		// Create webhook using operator-sdk
+		args := []string{"create", "webhook", "--group", crd.Group, "--version", crd.Version, "--kind", crd.Kind, "--make=false"}
+		for _, webhookType := range []string{"mutating", "validating", "conversion"} {
+			if flags[webhookFlags[webhookType]] {
+				args = append(args, webhookFlags[webhookType])
+			}
+		}
+		if flags[webhookFlags["conversion"]] {
+			// the hub of a multi-version CRD: operator-sdk scaffolds its Hub
+			// method and the conversion functions of every spoke
+			for _, version := range crd.Versions {
+				if version.Name != crd.Version {
+					args = append(args, "--spoke", version.Name)
+				}
+			}
+		}
+
+		webhookCmd := exec.CommandContext(ctx, "operator-sdk", args...)
+		webhookCmd.Dir = projectDir
+		webhookCmd.Env = env
+		if _, err := g.runCommand(StepCreateWebhook, crd.Kind, webhookCmd); err != nil {
+			for _, webhook := range enabled {
+				results = append(results, webhookResult(crd, webhook, WebhookFailed, "operator-sdk create webhook failed"))
+			}
+			return results, err
+		}
+		log.Printf("Webhooks created successfully for %s", crd.Kind)
+
+		for _, webhook := range enabled {
+			// conversion webhooks are configured in the CRD, not by a marker
+			if webhook.Type == "conversion" {
+				results = append(results, webhookResult(crd, webhook, WebhookCreated, ""))
+				continue
+			}
+			if err := g.runStep(StepWebhookPath, crd.Kind, func() error {
+				return updateWebhookMarker(projectDir, crd, webhook)
+			}); err != nil {
+				log.Printf("Warning: Failed to update %s webhook configuration for %s: %v", webhook.Type, crd.Kind, err)
+				results = append(results, webhookResult(crd, webhook, WebhookFailed, "scaffolded, but its settings were not applied: "+err.Error()))
+				continue
+			}
+			results = append(results, webhookResult(crd, webhook, WebhookCreated, ""))
+		}
+	}
+	return results, nil
+}
+
+// webhookMarkerPrefix starts the markers controller-gen reads admission
+// webhook configurations from.
+const webhookMarkerPrefix = "+kubebuilder:webhook:"
+
+// markerArg is one key=value argument of a marker.
+type markerArg struct {
+	key, value string
+}
+
+// webhookMarkerArgs returns the marker arguments that webhook sets, in the
+// order kubebuilder writes them.
+func webhookMarkerArgs(webhook WebhookConfig) []markerArg {
+	var args []markerArg
+	set := func(key, value string) {
+		if value != "" {
+			args = append(args, markerArg{key, value})
+		}
+	}
+	set("path", webhook.Path)
+	set("failurePolicy", webhook.FailurePolicy)
+	set("sideEffects", webhook.SideEffects)
+	set("matchPolicy", webhook.MatchPolicy)
+	set("resources", strings.Join(webhook.Resources, ";"))
+	// the marker lists verbs in lower case, e.g. verbs=create;update
+	set("verbs", strings.ToLower(strings.Join(webhook.Operations, ";")))
+	set("admissionReviewVersions", strings.Join(webhook.AdmissionReviewVersions, ";"))
+	if webhook.TimeoutSeconds > 0 {
+		set("timeoutSeconds", strconv.Itoa(webhook.TimeoutSeconds))
+	}
+	return args
+}
+
+// webhookFile returns the file operator-sdk scaffolds the webhooks of crd
+// into: internal/webhook/[<group>/]<version>/<kind>_webhook.go.
+func webhookFile(projectDir string, crd CRD) string {
+	name := strings.ToLower(crd.Kind) + "_webhook.go"
+	multiGroup := filepath.Join(projectDir, "internal", "webhook", crd.Group, crd.Version, name)
+	if _, err := os.Stat(multiGroup); err == nil {
+		return multiGroup
+	}
+	return filepath.Join(projectDir, "internal", "webhook", crd.Version, name)
+}
+
+// updateWebhookMarker applies the settings of a mutating or validating webhook
+// to its +kubebuilder:webhook marker, leaving the marker of the other type in
+// the same file alone. Selectors, which have no marker arguments, are added as
+// a kustomize patch.
+func updateWebhookMarker(projectDir string, crd CRD, webhook WebhookConfig) error {
+	file := webhookFile(projectDir, crd)
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		log.Printf("Webhook file does not exist, skipping webhook configuration: %s", file)
+		return nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read webhook file %s: %w", file, err)
+	}
+
+	mutating := webhook.Type == "mutating"
+	settings := webhookMarkerArgs(webhook)
+	lines := strings.Split(string(content), "\n")
+	name := ""
+	for i, line := range lines {
+		start, end, args, ok := parseWebhookMarker(line)
+		if !ok || (markerArgValue(args, "mutating") == "true") != mutating {
+			continue
+		}
+		for _, setting := range settings {
+			args = setMarkerArg(args, setting)
+		}
+		lines[i] = line[:start] + formatMarkerArgs(args) + line[end:]
+		name = markerArgValue(args, "name")
+	}
+	if name == "" {
+		return fmt.Errorf("no %s webhook marker with a name in %s", webhook.Type, file)
+	}
+
+	if len(settings) > 0 {
+		if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+			return fmt.Errorf("failed to write updated webhook file %s: %w", file, err)
+		}
+		log.Printf("Updated %s webhook marker of %s in: %s", webhook.Type, crd.Kind, file)
+	}
+
+	// controller-gen has no markers for selectors, they are patched into the
+	// generated webhook configuration by kustomize
+	if webhook.NamespaceSelector != nil || webhook.ObjectSelector != nil {
+		if err := addWebhookSelectorsPatch(projectDir, crd, webhook, name); err != nil {
+			return fmt.Errorf("failed to add webhook selectors: %w", err)
+		}
+	}
+	return nil
+}
+
+// parseWebhookMarker splits a +kubebuilder:webhook marker comment into its
+// arguments, which are line[start:end].
+func parseWebhookMarker(line string) (start, end int, args []markerArg, ok bool) {
+	if !strings.HasPrefix(strings.TrimSpace(line), "//") || !strings.HasPrefix(normalizeMarker(line), webhookMarkerPrefix) {
+		return 0, 0, nil, false
+	}
+	start = strings.Index(line, webhookMarkerPrefix) + len(webhookMarkerPrefix)
+	end = len(strings.TrimRight(line, " \t\r"))
+	return start, end, parseMarkerArgs(line[start:end]), true
+}
+
+// parseMarkerArgs splits the comma-separated key=value arguments of a marker,
+// keeping commas inside quotes or braces within their value.
+func parseMarkerArgs(s string) []markerArg {
+	var args []markerArg
+	add := func(arg string) {
+		key, value, _ := strings.Cut(arg, "=")
+		args = append(args, markerArg{strings.TrimSpace(key), strings.TrimSpace(value)})
+	}
+	depth, quote, begin := 0, rune(0), 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '`':
+			quote = r
+		case r == '{':
+			depth++
+		case r == '}':
+			depth--
+		case r == ',' && depth == 0:
+			add(s[begin:i])
+			begin = i + 1
+		}
+	}
+	add(s[begin:])
+	return args
+}
+
+func formatMarkerArgs(args []markerArg) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.key
+		if arg.value != "" {
+			parts[i] += "=" + arg.value
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// setMarkerArg replaces the value of arg.key in args or appends arg.
+func setMarkerArg(args []markerArg, arg markerArg) []markerArg {
+	for i := range args {
+		if args[i].key == arg.key {
+			args[i].value = arg.value
+			return args
+		}
+	}
+	return append(args, arg)
+}
+
+func markerArgValue(args []markerArg, key string) string {
+	for _, arg := range args {
+		if arg.key == key {
+			return arg.value
+		}
+	}
+	return ""
+}
+
+// webhookSelectorsPatch is a strategic merge patch of the webhook
+// configuration generated by controller-gen. Its webhooks are merged by name.
+type webhookSelectorsPatch struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+	Metadata   struct {
+		Name string `yaml:"name"`
+	} `yaml:"metadata"`
+	Webhooks []webhookSelectors `yaml:"webhooks"`
+}
+
+type webhookSelectors struct {
+	Name              string         `yaml:"name"`
+	NamespaceSelector *LabelSelector `yaml:"namespaceSelector,omitempty"`
+	ObjectSelector    *LabelSelector `yaml:"objectSelector,omitempty"`
+}
+
+// addWebhookSelectorsPatch writes the namespace and object selectors of the
+// webhook called name to a patch in config/webhook and adds it to the
+// kustomization there.
+func addWebhookSelectorsPatch(projectDir string, crd CRD, webhook WebhookConfig, name string) error {
+	patch := webhookSelectorsPatch{APIVersion: "admissionregistration.k8s.io/v1"}
+	if webhook.Type == "mutating" {
+		patch.Kind = "MutatingWebhookConfiguration"
+		patch.Metadata.Name = "mutating-webhook-configuration"
+	} else {
+		patch.Kind = "ValidatingWebhookConfiguration"
+		patch.Metadata.Name = "validating-webhook-configuration"
+	}
+	patch.Webhooks = []webhookSelectors{{Name: name, NamespaceSelector: webhook.NamespaceSelector, ObjectSelector: webhook.ObjectSelector}}
+
+	content, err := encodeYAML(&patch)
+	if err != nil {
+		return err
+	}
+	webhookDir := filepath.Join(projectDir, "config", "webhook")
+	patchFile := fmt.Sprintf("%s_%s_%s_%s_selectors_patch.yaml", crd.Group, crd.Version, strings.ToLower(crd.Kind), webhook.Type)
+	if err := os.WriteFile(filepath.Join(webhookDir, patchFile), content, 0644); err != nil {
+		return err
+	}
+	if err := addKustomizationPatch(filepath.Join(webhookDir, "kustomization.yaml"), patchFile); err != nil {
+		return err
+	}
+	log.Printf("Added webhook selectors of %s in: %s", name, patchFile)
+	return nil
+}
+
+// addKustomizationPatch adds path to the patches of the kustomization file,
+// keeping its comments.
+func addKustomizationPatch(kustomizationFile, path string) error {
+	content, err := os.ReadFile(kustomizationFile)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return fmt.Errorf("parse %s: %w", kustomizationFile, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a kustomization", kustomizationFile)
+	}
+	root := doc.Content[0]
+
+	var patches *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "patches" {
+			patches = root.Content[i+1]
+		}
+	}
+	if patches == nil {
+		patches = &yaml.Node{}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "patches"}, patches)
+	}
+	if patches.Kind != yaml.SequenceNode {
+		// a "patches:" key without entries is null
+		*patches = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	}
+	for _, entry := range patches.Content {
+		for i := 0; i+1 < len(entry.Content); i += 2 {
+			if entry.Content[i].Value == "path" && entry.Content[i+1].Value == path {
+				return nil
+			}
+		}
+	}
+	patches.Content = append(patches.Content, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Content: []*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "path"},
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: path},
+	}})
+
+	out, err := encodeYAML(&doc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(kustomizationFile, out, 0644)
+}
+
+// encodeYAML encodes v with the two-space indentation of kubebuilder's
+// manifests.
+func encodeYAML(v interface{}) ([]byte, error) {
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
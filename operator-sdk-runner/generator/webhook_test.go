@@ -0,0 +1,321 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMarkerArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []markerArg
+	}{
+		{
+			name: "plain arguments",
+			in:   "path=/mutate-v1-foo,mutating=true,failurePolicy=fail",
+			want: []markerArg{{"path", "/mutate-v1-foo"}, {"mutating", "true"}, {"failurePolicy", "fail"}},
+		},
+		{
+			name: "flag without a value",
+			in:   "optional,name=x",
+			want: []markerArg{{"optional", ""}, {"name", "x"}},
+		},
+		{
+			name: "comma in double quotes",
+			in:   `name="a,b",sideEffects=None`,
+			want: []markerArg{{"name", `"a,b"`}, {"sideEffects", "None"}},
+		},
+		{
+			name: "comma in backquotes",
+			in:   "pattern=`^a,b$`,x=y",
+			want: []markerArg{{"pattern", "`^a,b$`"}, {"x", "y"}},
+		},
+		{
+			name: "comma in braces",
+			in:   "verbs={create,update},groups=apps",
+			want: []markerArg{{"verbs", "{create,update}"}, {"groups", "apps"}},
+		},
+		{
+			name: "surrounding spaces",
+			in:   " path = /x , name=y",
+			want: []markerArg{{"path", "/x"}, {"name", "y"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseMarkerArgs(tt.in)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMarkerArgs(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// testWebhookGo holds the markers operator-sdk scaffolds for a Kind with
+// mutating and validating webhooks.
+const testWebhookGo = `package v1
+
+// +kubebuilder:webhook:path=/mutate-apps-example-com-v1-foo,mutating=true,failurePolicy=fail,sideEffects=None,groups=apps.example.com,resources=foos,verbs=create;update,versions=v1,name=mfoo-v1.kb.io,admissionReviewVersions=v1
+
+// +kubebuilder:webhook:path=/validate-apps-example-com-v1-foo,mutating=false,failurePolicy=fail,sideEffects=None,groups=apps.example.com,resources=foos,verbs=create;update,versions=v1,name=vfoo-v1.kb.io,admissionReviewVersions=v1
+`
+
+func TestUpdateWebhookMarker(t *testing.T) {
+	mutatingMarker := "// +kubebuilder:webhook:path=/mutate-apps-example-com-v1-foo,mutating=true,failurePolicy=fail,sideEffects=None,groups=apps.example.com,resources=foos,verbs=create;update,versions=v1,name=mfoo-v1.kb.io,admissionReviewVersions=v1"
+	validatingMarker := "// +kubebuilder:webhook:path=/validate-apps-example-com-v1-foo,mutating=false,failurePolicy=fail,sideEffects=None,groups=apps.example.com,resources=foos,verbs=create;update,versions=v1,name=vfoo-v1.kb.io,admissionReviewVersions=v1"
+
+	tests := []struct {
+		name    string
+		content string // defaults to testWebhookGo
+		webhook WebhookConfig
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "no settings",
+			webhook: WebhookConfig{Type: "mutating"},
+			want:    []string{mutatingMarker, validatingMarker},
+		},
+		{
+			name:    "mutating settings without a path",
+			webhook: WebhookConfig{Type: "mutating", FailurePolicy: "Ignore", Operations: []string{"CREATE"}, TimeoutSeconds: 5},
+			want: []string{
+				"// +kubebuilder:webhook:path=/mutate-apps-example-com-v1-foo,mutating=true,failurePolicy=Ignore,sideEffects=None,groups=apps.example.com,resources=foos,verbs=create,versions=v1,name=mfoo-v1.kb.io,admissionReviewVersions=v1,timeoutSeconds=5",
+				validatingMarker,
+			},
+		},
+		{
+			name:    "validating path and resources",
+			webhook: WebhookConfig{Type: "validating", Path: "/check", Resources: []string{"foos", "foos/status"}},
+			want: []string{
+				mutatingMarker,
+				"// +kubebuilder:webhook:path=/check,mutating=false,failurePolicy=fail,sideEffects=None,groups=apps.example.com,resources=foos;foos/status,verbs=create;update,versions=v1,name=vfoo-v1.kb.io,admissionReviewVersions=v1",
+			},
+		},
+		{
+			name:    "no marker of the type",
+			content: "package v1\n\n" + mutatingMarker + "\n",
+			webhook: WebhookConfig{Type: "validating", FailurePolicy: "Ignore"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			file := filepath.Join(dir, "internal", "webhook", "v1", "foo_webhook.go")
+			if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			content := tt.content
+			if content == "" {
+				content = testWebhookGo
+			}
+			if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			err := updateWebhookMarker(dir, CRD{Group: "apps", Version: "v1", Kind: "Foo"}, tt.webhook)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("updateWebhookMarker error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			updated, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var markers []string
+			for _, line := range strings.Split(string(updated), "\n") {
+				if strings.HasPrefix(line, "// +kubebuilder:webhook:") {
+					markers = append(markers, line)
+				}
+			}
+			if !reflect.DeepEqual(markers, tt.want) {
+				t.Errorf("markers = %q\nwant %q", markers, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyWebhookMarker(t *testing.T) {
+	args := parseMarkerArgs("path=/check,mutating=false,failurePolicy=Ignore,sideEffects=None,matchPolicy=Equivalent,resources=foos;foos/status,verbs=create;delete,admissionReviewVersions=v1;v1beta1,timeoutSeconds=7,name=vfoo-v1.kb.io")
+	want := WebhookConfig{
+		Path:                    "/check",
+		FailurePolicy:           "Ignore",
+		SideEffects:             "None",
+		MatchPolicy:             "Equivalent",
+		Resources:               []string{"foos", "foos/status"},
+		Operations:              []string{"CREATE", "DELETE"},
+		AdmissionReviewVersions: []string{"v1", "v1beta1"},
+		TimeoutSeconds:          7,
+	}
+	var got WebhookConfig
+	applyWebhookMarker(&got, args)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("applyWebhookMarker() = %+v, want %+v", got, want)
+	}
+	if back := webhookMarkerArgs(got); !reflect.DeepEqual(back, []markerArg{
+		{"path", "/check"}, {"failurePolicy", "Ignore"}, {"sideEffects", "None"}, {"matchPolicy", "Equivalent"},
+		{"resources", "foos;foos/status"}, {"verbs", "create;delete"}, {"admissionReviewVersions", "v1;v1beta1"}, {"timeoutSeconds", "7"},
+	}) {
+		t.Errorf("webhookMarkerArgs() = %q", back)
+	}
+}
+
+// fakeOperatorSDK is an operator-sdk that records its arguments and
+// scaffolds testWebhookGo, or fails when FAKE_SDK_FAIL is set.
+const fakeOperatorSDK = `#!/bin/sh
+echo "$@" >> "$FAKE_SDK_ARGS"
+if [ -n "$FAKE_SDK_FAIL" ]; then
+	echo "Error: failed to create webhook" >&2
+	exit 1
+fi
+mkdir -p internal/webhook/v1
+cp "$FAKE_SDK_WEBHOOK" internal/webhook/v1/foo_webhook.go
+`
+
+func TestCreateWebhooks(t *testing.T) {
+	enabled, disabled := true, false
+	crd := func(webhooks ...WebhookConfig) CRD {
+		return CRD{Group: "apps", Version: "v1", Kind: "Foo", Webhooks: webhooks}
+	}
+
+	tests := []struct {
+		name     string
+		crd      CRD
+		existing bool // the webhook file exists before
+		fail     bool // operator-sdk fails
+		wantArgs []string
+		want     []string // type:status of each result
+		wantErr  string
+	}{
+		{
+			name: "unset enabled means enabled",
+			crd:  crd(WebhookConfig{Type: "mutating"}, WebhookConfig{Type: "validating", Enabled: &enabled}),
+			wantArgs: []string{
+				"create webhook --group apps --version v1 --kind Foo --make=false --defaulting --programmatic-validation",
+			},
+			want: []string{"mutating:created", "validating:created"},
+		},
+		{
+			name:     "disabled webhooks are skipped",
+			crd:      crd(WebhookConfig{Type: "mutating", Enabled: &disabled}, WebhookConfig{Type: "validating"}),
+			wantArgs: []string{"create webhook --group apps --version v1 --kind Foo --make=false --programmatic-validation"},
+			want:     []string{"mutating:skipped", "validating:created"},
+		},
+		{
+			name: "all disabled",
+			crd:  crd(WebhookConfig{Type: "mutating", Enabled: &disabled}),
+			want: []string{"mutating:skipped"},
+		},
+		{
+			name: "conversion with spokes",
+			crd: CRD{Group: "apps", Version: "v2", Kind: "Foo", Webhooks: []WebhookConfig{{Type: "conversion"}},
+				Versions: []CRDVersion{{Name: "v1"}, {Name: "v2", Storage: true}}},
+			wantArgs: []string{"create webhook --group apps --version v2 --kind Foo --make=false --conversion --spoke v1"},
+			want:     []string{"conversion:created"},
+		},
+		{
+			name:    "unknown type",
+			crd:     crd(WebhookConfig{Type: "mutating", Enabled: &disabled}, WebhookConfig{Type: "defaulting"}),
+			want:    []string{"mutating:skipped"},
+			wantErr: "Unknown webhook type",
+		},
+		{
+			name:    "two webhooks of a type",
+			crd:     crd(WebhookConfig{Type: "validating"}, WebhookConfig{Type: "validating"}),
+			wantErr: "Conflicting webhooks",
+		},
+		{
+			name:     "webhook file exists",
+			crd:      crd(WebhookConfig{Type: "mutating"}),
+			existing: true,
+			wantErr:  "Conflicting webhooks",
+		},
+		{
+			name:     "operator-sdk fails",
+			crd:      crd(WebhookConfig{Type: "mutating"}, WebhookConfig{Type: "validating"}),
+			fail:     true,
+			wantArgs: []string{"create webhook --group apps --version v1 --kind Foo --make=false --defaulting --programmatic-validation"},
+			want:     []string{"mutating:failed", "validating:failed"},
+			wantErr:  "exit status 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			bin := filepath.Join(tmp, "bin")
+			projectDir := filepath.Join(tmp, "project")
+			argsFile := filepath.Join(tmp, "args")
+			webhookGo := filepath.Join(tmp, "webhook.go")
+			for _, dir := range []string{bin, projectDir} {
+				if err := os.MkdirAll(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(filepath.Join(bin, "operator-sdk"), []byte(fakeOperatorSDK), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(webhookGo, []byte(testWebhookGo), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.existing {
+				existing := webhookFile(projectDir, tt.crd)
+				if err := os.MkdirAll(filepath.Dir(existing), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(existing, []byte(testWebhookGo), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// exec.Command looks operator-sdk up in the PATH of the test
+			t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+			env := append(os.Environ(), "FAKE_SDK_ARGS="+argsFile, "FAKE_SDK_WEBHOOK="+webhookGo)
+			if tt.fail {
+				env = append(env, "FAKE_SDK_FAIL=1")
+			}
+
+			results, err := (&Generator{}).CreateWebhooks(context.Background(), projectDir, []CRD{tt.crd}, env)
+
+			var got []string
+			for _, r := range results {
+				got = append(got, fmt.Sprintf("%s:%s", r.Type, r.Status))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("results = %v, want %v", got, tt.want)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CreateWebhooks: %v", err)
+				}
+			} else {
+				var genErr *Error
+				if !errors.As(err, &genErr) {
+					t.Fatalf("CreateWebhooks error = %v, want an *Error", err)
+				}
+				if genErr.Message != tt.wantErr {
+					t.Errorf("error = %q, want %q", genErr.Message, tt.wantErr)
+				}
+				if !reflect.DeepEqual(genErr.Webhooks, results) {
+					t.Errorf("error webhooks = %v, want the results %v", genErr.Webhooks, results)
+				}
+			}
+
+			var gotArgs []string
+			if content, err := os.ReadFile(argsFile); err == nil {
+				gotArgs = strings.Split(strings.TrimSpace(string(content)), "\n")
+			}
+			if !reflect.DeepEqual(gotArgs, tt.wantArgs) {
+				t.Errorf("operator-sdk calls = %q, want %q", gotArgs, tt.wantArgs)
+			}
+		})
+	}
+}
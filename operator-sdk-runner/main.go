@@ -2,187 +2,210 @@ package main
 
 import (
 	"archive/zip"
-	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"go/parser"
-	"go/token"
-	"io"
-	"io/fs"
 	"log"
+	"mime/multipart"
+	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/dave/dst"
-	"github.com/dave/dst/decorator"
-	"github.com/dave/dst/dstutil"
 	"github.com/gin-gonic/gin"
+
+	"osdk-runner/generator"
 )
 
-func hasMultipleGroups(crds []CRD) bool {
-	if len(crds) <= 1 {
-		return false
-	}
+// runLogs holds the event logs of the generations served by this runner,
+// keyed by the ID from the generator.RunIDHeader request header. A log may
+// be created by a follower before its generation starts, but is closed and
+// forgotten unless its generation claims it within unclaimedRunLogTTL, so
+// following an unknown run does not wait forever. Generations without a run
+// ID are not logged, as they cannot be told apart.
+var runLogs = struct {
+	sync.Mutex
+	logs map[string]*runLogEntry
+}{logs: map[string]*runLogEntry{}}
+
+type runLogEntry struct {
+	events  *generator.EventLog
+	claimed bool
+}
 
-	firstGroup := crds[0].Group
-	for _, crd := range crds[1:] {
-		if crd.Group != firstGroup {
-			return true
+// unclaimedRunLogTTL is how long a log created by a follower waits for its
+// generation request.
+const unclaimedRunLogTTL = 2 * time.Minute
+
+// runLog returns the event log of runID, creating it if needed. The
+// generation of runID passes claim to keep the log until finishRunLog.
+func runLog(runID string, claim bool) *generator.EventLog {
+	runLogs.Lock()
+	defer runLogs.Unlock()
+	entry, ok := runLogs.logs[runID]
+	if !ok {
+		entry = &runLogEntry{events: generator.NewEventLog()}
+		runLogs.logs[runID] = entry
+		if !claim {
+			time.AfterFunc(unclaimedRunLogTTL, func() {
+				runLogs.Lock()
+				defer runLogs.Unlock()
+				if !entry.claimed {
+					entry.events.Close()
+					forgetRunLog(runID, entry)
+				}
+			})
 		}
 	}
-	return false
+	entry.claimed = entry.claimed || claim
+	return entry.events
 }
 
-func runOperatorSDK(c *gin.Context) {
-	log.Printf("Received POST request to /v1/run")
-
-	var request OperatorData
-	if err := c.ShouldBindJSON(&request); err != nil {
-		log.Printf("Error parsing request payload: %v", err)
-		c.JSON(400, gin.H{"error": "Invalid request payload", "details": err.Error()})
+// finishRunLog closes the event log of runID and forgets it once late
+// followers had time to replay it.
+func finishRunLog(runID string) {
+	runLogs.Lock()
+	entry := runLogs.logs[runID]
+	runLogs.Unlock()
+	if entry == nil {
 		return
 	}
+	entry.events.Close()
+	time.AfterFunc(time.Minute, func() {
+		runLogs.Lock()
+		defer runLogs.Unlock()
+		forgetRunLog(runID, entry)
+	})
+}
+
+// forgetRunLog removes entry from runLogs unless runID was reused since. The
+// caller holds runLogs.
+func forgetRunLog(runID string, entry *runLogEntry) {
+	if runLogs.logs[runID] == entry {
+		delete(runLogs.logs, runID)
+	}
+}
 
-	log.Printf("Request parsed successfully: Domain=%s, Repo=%s, ProjectName=%s, CRDs=%d",
-		request.Domain, request.Repo, request.ProjectName, len(request.CRDs))
+// poolMode keeps the runner serving after its first request, and cacheDir
+// holds the Go caches it shares between requests. modCache and offline
+// configure a pre-seeded module cache for generating without network access.
+var (
+	poolMode bool
+	cacheDir string
+	modCache string
+	offline  bool
+	warm     atomic.Bool
+)
 
-	needsMultiGroup := hasMultipleGroups(request.CRDs)
-	log.Printf("Multi-group layout needed: %v", needsMultiGroup)
+// newGenerator returns a Generator configured from the runner's flags.
+func newGenerator() generator.Generator {
+	return generator.Generator{CacheDir: cacheDir, ModCache: modCache, Offline: offline}
+}
+
+// generateFromRequest binds the OperatorData payload and generates the project
+// into a new temporary directory, which the caller removes once it served the
+// result. A multipart request instead carries the OperatorData in its "data"
+// field and the archive of an existing project in its "project" field, to
+// which only the new APIs and webhooks are added. On failure it writes the
+// error response and returns nil.
+func generateFromRequest(c *gin.Context) *generator.Result {
+	// claim the run's log first, so it is closed whichever way this ends
+	runID := c.GetHeader(generator.RunIDHeader)
+	g := newGenerator()
+	if runID != "" {
+		g.OnEvent = runLog(runID, true).Add
+		defer finishRunLog(runID)
+	}
+
+	var request generator.OperatorData
+	var project *multipart.FileHeader
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		var err error
+		if project, err = c.FormFile("project"); err != nil {
+			log.Printf("Error reading project archive: %v", err)
+			c.JSON(400, gin.H{"error": "Invalid project archive", "details": err.Error()})
+			return nil
+		}
+		if err := json.Unmarshal([]byte(c.PostForm("data")), &request); err != nil {
+			log.Printf("Error parsing request payload: %v", err)
+			c.JSON(400, gin.H{"error": "Invalid request payload", "details": err.Error()})
+			return nil
+		}
+	} else if err := c.ShouldBindJSON(&request); err != nil {
+		log.Printf("Error parsing request payload: %v", err)
+		c.JSON(400, gin.H{"error": "Invalid request payload", "details": err.Error()})
+		return nil
+	}
 
 	// build in /tmp
 	tmpDir, err := os.MkdirTemp("/tmp", "sdk-")
 	if err != nil {
 		log.Printf("Error creating temporary directory: %v", err)
 		c.JSON(500, gin.H{"error": "Failed to create temporary directory", "details": err.Error()})
-		return
+		return nil
 	}
 	log.Printf("Created temporary directory: %s", tmpDir)
 
-	// setup a writable Go environment inside a subdir of the temp dir
-	cachesRoot := filepath.Join(tmpDir, ".osdk_cache")
-	goCacheDir := filepath.Join(cachesRoot, "gocache")
-	goModCache := filepath.Join(cachesRoot, "pkg", "mod")
-	goPath := filepath.Join(cachesRoot, "gopath")
-	if err := os.MkdirAll(goCacheDir, 0o700); err != nil {
-		log.Printf("Warning: failed to create go cache dir %s: %v", goCacheDir, err)
-	}
-	if err := os.MkdirAll(goModCache, 0o700); err != nil {
-		log.Printf("Warning: failed to create go mod cache %s: %v", goModCache, err)
-	}
-	if err := os.MkdirAll(goPath, 0o700); err != nil {
-		log.Printf("Warning: failed to create GOPATH dir %s: %v", goPath, err)
-	}
-	log.Printf("Go env caches created under: %s", cachesRoot)
-
-	cmdEnv := append(os.Environ(),
-		"GOCACHE="+goCacheDir,
-		"GOMODCACHE="+goModCache,
-		"GOPATH="+goPath,
-		"HOME="+tmpDir,
-	)
-
-	log.Printf("Running operator-sdk init with domain=%s, repo=%s", request.Domain, request.Repo)
-	initArgs := []string{"init", "--domain", request.Domain, "--repo", request.Repo}
-	initCmd := exec.Command("operator-sdk", initArgs...)
-	initCmd.Dir = tmpDir
-
-	output, err := initCmd.CombinedOutput()
-	if err != nil {
-		log.Printf("operator-sdk init failed: %v, output: %s", err, string(output))
-		c.JSON(500, gin.H{"error": "operator-sdk init failed", "details": string(output)})
-		return
-	}
-	log.Printf("operator-sdk init completed successfully")
-
-	// Enable multigroup layout if needed
-	if needsMultiGroup {
-		log.Printf("Enabling multigroup layout")
-		editCmd := exec.Command("operator-sdk", "edit", "--multigroup=true")
-		editCmd.Dir = tmpDir
-		editCmd.Env = cmdEnv
-		editOutput, editErr := editCmd.CombinedOutput()
-		if editErr != nil {
-			log.Printf("operator-sdk edit --multigroup=true failed: %v, output: %s", editErr, string(editOutput))
-			c.JSON(500, gin.H{"error": "Failed to enable multigroup layout", "details": string(editOutput)})
-			return
+	if project != nil {
+		if err := extractProject(project, tmpDir); err != nil {
+			log.Printf("Error extracting project archive: %v", err)
+			os.RemoveAll(tmpDir)
+			c.JSON(400, gin.H{"error": "Invalid project archive", "details": err.Error()})
+			return nil
 		}
-		log.Printf("Multigroup layout enabled successfully")
 	}
 
-	tidyCmd := exec.Command("go", "mod", "tidy")
-	tidyCmd.Dir = tmpDir
-	tidyCmd.Env = cmdEnv
-	tidyOut, tidyErr := tidyCmd.CombinedOutput()
-	if tidyErr != nil {
-		log.Printf("Warning: go mod tidy failed: %v, output: %s", tidyErr, string(tidyOut))
+	var result *generator.Result
+	if project != nil {
+		result, err = g.GenerateIncremental(c.Request.Context(), request, tmpDir)
 	} else {
-		log.Printf("Ran go mod tidy successfully")
+		result, err = g.Generate(c.Request.Context(), request, tmpDir)
 	}
-	log.Printf("Go modules prepared successfully")
-
-	// Run operator-sdk create api for each CRD
-	log.Printf("Creating APIs for %d CRDs", len(request.CRDs))
-	for i, crd := range request.CRDs {
-		log.Printf("Creating API %d/%d: Group=%s, Version=%s, Kind=%s, Controller=%t",
-			i+1, len(request.CRDs), crd.Group, crd.Version, crd.Kind, crd.Controller)
-		args := []string{"create", "api", "--resource", "--group", crd.Group, "--version", crd.Version, "--kind", crd.Kind, "--make=false"}
-		if crd.Controller {
-			args = append(args, "--controller")
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		var genErr *generator.Error
+		if errors.As(err, &genErr) {
+			c.JSON(500, genErr)
 		} else {
-			args = append(args, "--controller=false")
-		}
-		apiCmd := exec.Command("operator-sdk", args...)
-		apiCmd.Dir = tmpDir
-		apiCmd.Env = cmdEnv
-		output, err := apiCmd.CombinedOutput()
-		if err != nil {
-			log.Printf("operator-sdk create api failed for %s: %s\n%s", crd.Kind, err, output)
-			c.JSON(500, gin.H{"error": "operator-sdk create api failed for " + crd.Kind, "details": string(output)})
-			return
+			c.JSON(500, gin.H{"error": "Failed to generate project", "details": err.Error()})
 		}
-		log.Printf("API created successfully for %s", crd.Kind)
+		return nil
 	}
+	return result
+}
 
-	// Update Go type files with properties
-	log.Printf("Updating Go type files with properties")
-	if err := UpdateGoTypesDST(tmpDir, request.CRDs); err != nil {
-		log.Printf("Error updating Go type files: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to update Go type files", "details": err.Error()})
-		return
+// extractProject extracts an uploaded project archive into dir.
+func extractProject(header *multipart.FileHeader, dir string) error {
+	file, err := header.Open()
+	if err != nil {
+		return err
 	}
-	log.Printf("Go type files updated successfully")
-
-	// Add RBAC markers to controller files
-	log.Printf("Adding RBAC markers to controller files")
-	if err := UpdateControllerRBAC(tmpDir, request.CRDs); err != nil {
-		log.Printf("Error updating controller RBAC: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to update controller RBAC", "details": err.Error()})
-		return
+	defer file.Close()
+	archive, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		return err
 	}
-	log.Printf("Controller RBAC markers added successfully")
+	return generator.ExtractProject(archive, dir)
+}
 
-	// Create webhooks for CRDs that have webhook configurations
-	log.Printf("Creating webhooks for CRDs")
-	if err := CreateWebhooks(tmpDir, request.CRDs); err != nil {
-		log.Printf("Error creating webhooks: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to create webhooks", "details": err.Error()})
-		return
-	}
-	log.Printf("Webhooks created successfully")
+func runOperatorSDK(c *gin.Context) {
+	log.Printf("Received POST request to /v1/run")
+	defer shutdownAfterResponse()
 
-	// Patch the generated main.go to set namespace scope
-	log.Printf("Patching main.go for namespace scope")
-	if err := PatchMainNamespaceScopeDST(tmpDir, []string{"default"}); err != nil {
-		log.Printf("Error patching main.go: %v", err)
-		c.JSON(500, gin.H{"error": "Failed to patch main.go for namespace scope", "details": err.Error()})
+	result := generateFromRequest(c)
+	if result == nil {
 		return
 	}
-	log.Printf("main.go patched successfully")
+	defer os.RemoveAll(result.Dir)
 
 	// Write the output to a zip file
 	log.Println("Creating zip file...")
-	zipFilePath := filepath.Join(tmpDir, "output.zip")
+	zipFilePath := filepath.Join(result.Dir, "output.zip")
 	zipFile, err := os.Create(zipFilePath)
 	if err != nil {
 		log.Printf("Error creating zip file: %v", err)
@@ -191,517 +214,201 @@ func runOperatorSDK(c *gin.Context) {
 	}
 	defer zipFile.Close()
 
-	if err := zipDir(tmpDir, zipFile); err != nil {
+	if err := result.WriteZip(zipFile); err != nil {
 		log.Printf("Error writing to zip file: %v", err)
 		c.JSON(500, gin.H{"error": "Failed to write to zip file", "details": err.Error()})
 		return
 	}
 	log.Println("Zip file created successfully.")
 
-	// Serve the zip file
+	// Serve the zip file, with the generation report in a header
+	if report, err := result.HeaderValue(); err == nil {
+		c.Header(generator.ResultHeader, report)
+	}
 	log.Printf("Serving zip file: %s", zipFilePath)
 	c.File(zipFilePath)
 	log.Printf("Zip file served successfully")
-
-	// Gracefully shut down the container after serving the file
-	log.Println("Shutting down the container...")
-	go func() {
-		os.Exit(0)
-	}()
 }
 
-func zipDir(srcDir string, w io.Writer) error {
-	log.Printf("Starting to zip directory: %s", srcDir)
-	zipWriter := zip.NewWriter(w)
-	defer func() {
-		log.Println("Closing zip writer")
-		zipWriter.Close()
-	}()
+// previewOperatorSDK generates the project and returns its file tree and
+// text file contents as JSON instead of a zip archive.
+func previewOperatorSDK(c *gin.Context) {
+	log.Printf("Received POST request to /v1/preview")
+	defer shutdownAfterResponse()
 
-	err := filepath.WalkDir(srcDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			log.Printf("Error accessing path %s: %v", path, err)
-			return err
-		}
-		log.Printf("Processing path: %s", path)
+	result := generateFromRequest(c)
+	if result == nil {
+		return
+	}
+	defer os.RemoveAll(result.Dir)
 
-		// Skip the output.zip file
-		if filepath.Base(path) == "output.zip" {
-			log.Printf("Skipping file: %s", path)
-			return nil
-		}
+	preview, err := result.Preview()
+	if err != nil {
+		log.Printf("Error listing generated files: %v", err)
+		c.JSON(500, gin.H{"error": "Failed to list generated files", "details": err.Error()})
+		return
+	}
+	log.Printf("Serving preview of %d files", len(preview.Files))
+	c.JSON(200, preview)
+}
 
-		if d.IsDir() {
-			log.Printf("Skipping directory: %s", path)
-			return nil
-		}
-		relPath, err := filepath.Rel(srcDir, path)
-		if err != nil {
-			log.Printf("Error getting relative path for %s: %v", path, err)
-			return err
-		}
-		log.Printf("Relative path: %s", relPath)
-		f, err := zipWriter.Create(relPath)
-		if err != nil {
-			log.Printf("Error creating zip entry for %s: %v", relPath, err)
-			return err
-		}
-		srcFile, err := os.Open(path)
-		if err != nil {
-			log.Printf("Error opening file %s: %v", path, err)
-			return err
-		}
-		defer srcFile.Close()
-		_, err = io.Copy(f, srcFile)
-		if err != nil {
-			log.Printf("Error copying file %s to zip: %v", path, err)
-			return err
-		}
-		log.Printf("Successfully added %s to zip", path)
+// streamLogs sends the events of the generation named by the run query
+// parameter as Server-Sent Events, replaying the ones that already happened,
+// until it finishes or, if it never starts, unclaimedRunLogTTL passes.
+func streamLogs(c *gin.Context) {
+	runID := c.Query("run")
+	if runID == "" {
+		c.JSON(400, gin.H{"error": "Missing run ID", "details": "the run query parameter is required"})
+		return
+	}
+	events := runLog(runID, false)
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(200)
+	c.Writer.Flush()
+	err := events.Follow(c.Request.Context(), func(e generator.Event) error {
+		c.SSEvent("step", e)
+		c.Writer.Flush()
 		return nil
 	})
 	if err != nil {
-		log.Printf("Error walking directory %s: %v", srcDir, err)
-		return err
+		return
 	}
-	log.Println("Finished zipping directory")
-	return nil
+	c.SSEvent("end", gin.H{})
+	c.Writer.Flush()
 }
 
-// UpdateGoTypesDST parses the generated *_types.go file with dave/dst,
-// finds the <Kind>Spec struct, then replaces the entire field list with
-// fields derived from the CRD.Properties slice.
-func UpdateGoTypesDST(projectDir string, crds []CRD) error {
-	needsMultiGroup := hasMultipleGroups(crds)
-	log.Printf("UpdateGoTypesDST: needsMultiGroup=%v", needsMultiGroup)
-
-	for _, crd := range crds {
-		var apiDir string
-		if needsMultiGroup {
-			// Multi-group layout: api/<group>/<version>/
-			apiDir = filepath.Join(projectDir, "api", crd.Group, crd.Version)
-		} else {
-			// Single-group layout: api/<version>/
-			apiDir = filepath.Join(projectDir, "api", crd.Version)
-		}
-		goFile := filepath.Join(apiDir, strings.ToLower(crd.Kind)+"_types.go")
-		log.Printf("UpdateGoTypesDST: Processing CRD %s.%s/%s, file path: %s", crd.Kind, crd.Group, crd.Version, goFile)
+// served is closed once the runner answered its generation request.
+var served = make(chan struct{})
 
-		fset := token.NewFileSet()
-		file, err := decorator.ParseFile(fset, goFile, nil, parser.ParseComments)
-		if err != nil {
-			return fmt.Errorf("parse %s: %w", goFile, err)
-		}
+var serveOnce sync.Once
 
-		// No enum type/const generation; only kubebuilder markers
-
-		dstutil.Apply(file, func(c *dstutil.Cursor) bool {
-			ts, ok := c.Node().(*dst.TypeSpec)
-			if !ok {
-				return true
-			}
-
-			// Handle the main Kind struct for CRD-level markers
-			if ts.Name.Name == crd.Kind {
-				if crd.Status {
-					// Add status subresource marker to the Kind struct
-					statusMarker := "// +kubebuilder:subresource:status"
-					ts.Decs.Start.Append(statusMarker)
-					log.Printf("Added status subresource marker to %s", crd.Kind)
-				}
-				return true
-			}
+// shutdownAfterResponse stops the runner once the current response has been
+// served, as every runner pod outside of a pool handles a single request. The
+// server drains open connections, such as a log stream, before the process
+// exits so the runner Job completes successfully.
+func shutdownAfterResponse() {
+	if poolMode {
+		return
+	}
+	serveOnce.Do(func() { close(served) })
+}
 
-			// Handle the KindSpec struct for property validation markers
-			if ts.Name.Name != crd.Kind+"Spec" {
-				return true
-			}
-			st, ok := ts.Type.(*dst.StructType)
-			if !ok {
-				return true
-			}
-			var fields []*dst.Field
-			for _, p := range crd.Properties {
-				goType := dst.NewIdent(GoTypeForProperty(p.Type))
-				markers := buildKubebuilderMarkers(p)
-				tags := fmt.Sprintf("json:\"%s,omitempty\"", p.Name)
-				field := &dst.Field{
-					Names: []*dst.Ident{dst.NewIdent(ToCamelCase(p.Name))},
-					Type:  goType,
-					Tag: &dst.BasicLit{
-						Kind:  token.STRING,
-						Value: fmt.Sprintf("`%s`", tags),
-					},
-				}
-				if len(markers) > 0 {
-					field.Decs.Start.Append(markers...)
-				}
-				fields = append(fields, field)
-			}
-			st.Fields.List = fields
-			return false
-		}, nil)
-		var buf bytes.Buffer
-		if err := decorator.Fprint(&buf, file); err != nil {
-			return fmt.Errorf("print %s: %w", goFile, err)
-		}
-		if err := os.WriteFile(goFile, buf.Bytes(), 0o644); err != nil {
-			return fmt.Errorf("write %s: %w", goFile, err)
-		}
-		log.Printf("Updated Go type file (dst): %s", goFile)
+// healthz answers 200 OK once the runner is warmed up and ready for work.
+func healthz(c *gin.Context) {
+	if !warm.Load() {
+		c.JSON(503, gin.H{"status": "warming up"})
+		return
 	}
-	return nil
+	c.JSON(200, gin.H{"status": "ok"})
 }
 
-// PatchMainNamespaceScopeDST updates the generated cmd/main.go to set namespace scope using dave/dst
-func PatchMainNamespaceScopeDST(projectDir string, namespaces []string) error {
-	mainPath := filepath.Join(projectDir, "cmd", "main.go")
-	fset := token.NewFileSet()
-	fileAst, err := decorator.ParseFile(fset, mainPath, nil, parser.ParseComments)
+// warmupRequest is a minimal project whose generation fills the shared caches
+// with the modules every scaffolded operator needs.
+var warmupRequest = generator.OperatorData{
+	Domain:      "example.com",
+	Repo:        "example.com/warmup",
+	ProjectName: "warmup",
+	CRDs: []generator.CRD{
+		{Group: "cache", Version: "v1alpha1", Kind: "Warmup", Controller: true},
+	},
+}
+
+// warmUp generates and discards warmupRequest with g, leaving the modules
+// and build results it needed in g's caches.
+func warmUp(g generator.Generator) error {
+	tmpDir, err := os.MkdirTemp("/tmp", "warmup-")
 	if err != nil {
-		return fmt.Errorf("parse main.go: %w", err)
-	}
-	found := false
-	dstutil.Apply(fileAst, func(c *dstutil.Cursor) bool {
-		cl, ok := c.Node().(*dst.CallExpr)
-		if !ok {
-			return true
-		}
-		// Look for ctrl.NewManager call
-		if sel, ok := cl.Fun.(*dst.SelectorExpr); ok && sel.Sel.Name == "NewManager" {
-			if len(cl.Args) == 2 {
-				if opts, ok := cl.Args[1].(*dst.CompositeLit); ok {
-					found = true
-					cacheFieldIdx := -1
-					for i, elt := range opts.Elts {
-						if kv, ok := elt.(*dst.KeyValueExpr); ok {
-							if ident, ok := kv.Key.(*dst.Ident); ok && ident.Name == "Cache" {
-								cacheFieldIdx = i
-								break
-							}
-						}
-					}
-					if len(namespaces) == 0 {
-						// Remove Cache field if present (cluster-scoped)
-						if cacheFieldIdx >= 0 {
-							opts.Elts = append(opts.Elts[:cacheFieldIdx], opts.Elts[cacheFieldIdx+1:]...)
-						}
-					} else {
-						// Set Cache.DefaultNamespaces to provided list
-						mapElts := []dst.Expr{}
-						for _, ns := range namespaces {
-							mapElts = append(mapElts, &dst.KeyValueExpr{
-								Key:   &dst.BasicLit{Kind: token.STRING, Value: fmt.Sprintf("\"%s\"", ns)},
-								Value: &dst.CompositeLit{Type: &dst.SelectorExpr{X: dst.NewIdent("cache"), Sel: dst.NewIdent("Config")}},
-							})
-						}
-						cacheConfig := &dst.KeyValueExpr{
-							Key: dst.NewIdent("Cache"),
-							Value: &dst.CompositeLit{
-								Type: &dst.SelectorExpr{
-									X:   dst.NewIdent("cache"),
-									Sel: dst.NewIdent("Options"),
-								},
-								Elts: []dst.Expr{
-									&dst.KeyValueExpr{
-										Key: dst.NewIdent("DefaultNamespaces"),
-										Value: &dst.CompositeLit{
-											Type: &dst.MapType{
-												Key:   dst.NewIdent("string"),
-												Value: &dst.SelectorExpr{X: dst.NewIdent("cache"), Sel: dst.NewIdent("Config")},
-											},
-											Elts: mapElts,
-										},
-									},
-								},
-							},
-						}
-						if cacheFieldIdx >= 0 {
-							opts.Elts[cacheFieldIdx] = cacheConfig
-						} else {
-							opts.Elts = append(opts.Elts, cacheConfig)
-						}
-					}
-				}
-			}
-		}
-		return true
-	}, nil)
-
-	// Ensure the import for 'sigs.k8s.io/controller-runtime/pkg/cache' exists in the existing import group
-	foundImport := false
-	dstutil.Apply(fileAst, func(c *dstutil.Cursor) bool {
-		genDecl, ok := c.Node().(*dst.GenDecl)
-		if !ok || genDecl.Tok != token.IMPORT {
-			return true
-		}
-		for _, spec := range genDecl.Specs {
-			importSpec, ok := spec.(*dst.ImportSpec)
-			if !ok {
-				continue
-			}
-			if importSpec.Path.Value == "\"sigs.k8s.io/controller-runtime/pkg/cache\"" {
-				foundImport = true
-				break
-			}
-		}
-		if !foundImport {
-			genDecl.Specs = append(genDecl.Specs, &dst.ImportSpec{
-				Path: &dst.BasicLit{
-					Kind:  token.STRING,
-					Value: "\"sigs.k8s.io/controller-runtime/pkg/cache\"",
-				},
-			})
-			foundImport = true
-		}
-		return false
-	}, nil)
-
-	if !foundImport {
-		// If no import group exists, create a new one
-		fileAst.Decls = append([]dst.Decl{
-			&dst.GenDecl{
-				Tok: token.IMPORT,
-				Specs: []dst.Spec{
-					&dst.ImportSpec{
-						Path: &dst.BasicLit{
-							Kind:  token.STRING,
-							Value: "\"sigs.k8s.io/controller-runtime/pkg/cache\"",
-						},
-					},
-				},
-			},
-		}, fileAst.Decls...)
+		return err
 	}
+	defer os.RemoveAll(tmpDir)
 
-	if found {
-		var buf bytes.Buffer
-		if err := decorator.Fprint(&buf, fileAst); err != nil {
-			return fmt.Errorf("print main.go: %w", err)
-		}
-		if err := os.WriteFile(mainPath, buf.Bytes(), 0644); err != nil {
-			return fmt.Errorf("write main.go: %w", err)
-		}
-		log.Printf("Patched main.go for namespace scope (dst): %s", mainPath)
-	}
-	return nil
+	_, err = g.Generate(context.Background(), warmupRequest, tmpDir)
+	return err
 }
 
-// buildKubebuilderMarkers builds Kubebuilder CRD validation markers for a property
-func buildKubebuilderMarkers(p Property) []string {
-	var markers []string
-	for _, v := range p.Validations {
-		switch v.Type {
-		case "minLength":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:validation:MinLength="+s)
-			}
-		case "maxLength":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:validation:MaxLength="+s)
-			}
-		case "pattern":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:validation:Pattern="+s)
-			}
-		case "minimum":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:validation:Minimum="+s)
-			}
-		case "maximum":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:validation:Maximum="+s)
-			}
-		case "multipleOf":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:validation:MultipleOf="+s)
-			}
-		case "uniqueItems":
-			if b, ok := v.Value.(bool); ok && b {
-				markers = append(markers, "+kubebuilder:validation:UniqueItems=true")
-			}
-		case "minItems":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:validation:MinItems="+s)
-			}
-		case "maxItems":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:validation:MaxItems="+s)
-			}
-		case "minProperties":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:validation:MinProperties="+s)
-			}
-		case "maxProperties":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:validation:MaxProperties="+s)
-			}
-		case "format":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:validation:Format="+s)
-			}
-		case "enum":
-			if vals, ok := v.Value.([]interface{}); ok && len(vals) > 0 {
-				var parts []string
-				for _, val := range vals {
-					if s, ok := val.(string); ok {
-						parts = append(parts, s)
-					}
-				}
-				if len(parts) > 0 {
-					markers = append(markers, "+kubebuilder:validation:Enum="+strings.Join(parts, ","))
-				}
-			} else if vals, ok := v.Value.([]string); ok && len(vals) > 0 {
-				markers = append(markers, "+kubebuilder:validation:Enum="+strings.Join(vals, ","))
-			}
-		case "required":
-			markers = append(markers, "+kubebuilder:validation:Required")
-		case "optional":
-			markers = append(markers, "+kubebuilder:validation:Optional")
-		case "default":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:default:="+s)
-			}
-		case "example":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:example:="+s)
-			}
-		case "type":
-			if s, ok := v.Value.(string); ok && s != "" {
-				markers = append(markers, "+kubebuilder:validation:Type="+s)
-			}
-		}
+// runOnce generates a single project from a JSON request file into outputDir
+// without starting the HTTP server.
+func runOnce(requestFile, outputDir string) error {
+	content, err := os.ReadFile(requestFile)
+	if err != nil {
+		return fmt.Errorf("read request file %s: %w", requestFile, err)
 	}
-	for i, m := range markers {
-		markers[i] = "// " + m
+	var request generator.OperatorData
+	if err := json.Unmarshal(content, &request); err != nil {
+		return fmt.Errorf("parse request file %s: %w", requestFile, err)
 	}
-	return markers
-}
-
-func GoTypeForProperty(openapiType string) string {
-	switch openapiType {
-	case "string":
-		return "string"
-	case "integer":
-		return "int"
-	case "number":
-		return "float64"
-	case "boolean":
-		return "bool"
-	case "array":
-		return "[]interface{}" // Could be improved with more info
-	case "object":
-		return "map[string]interface{}"
-	default:
-		return "interface{}"
+	g := newGenerator()
+	if _, err := os.Stat(filepath.Join(outputDir, "PROJECT")); err == nil {
+		log.Printf("%s already holds a project, adding the new APIs and webhooks", outputDir)
+		_, err = g.GenerateIncremental(context.Background(), request, outputDir)
+		return err
 	}
+	_, err = g.Generate(context.Background(), request, outputDir)
+	return err
 }
 
-// ToCamelCase converts snake_case or kebab-case to CamelCase
-func ToCamelCase(s string) string {
-	parts := strings.FieldsFunc(s, func(r rune) bool {
-		return r == '_' || r == '-'
-	})
-	for i, part := range parts {
-		if len(part) > 0 {
-			parts[i] = strings.ToUpper(part[:1]) + part[1:]
-		}
+func main() {
+	requestFile := flag.String("request", "", "Generate once from this OperatorData JSON file and exit instead of serving HTTP")
+	outputDir := flag.String("output", "", "Directory to scaffold into when -request is set; new APIs and webhooks are added to a project already there")
+	flag.BoolVar(&poolMode, "pool", false, "Keep serving after the first request, as a member of a warm runner pool")
+	flag.StringVar(&cacheDir, "cache-dir", "", "Directory for Go caches shared between requests (default: one cache per request)")
+	flag.StringVar(&modCache, "mod-cache", os.Getenv("OSDK_MOD_CACHE"), "Pre-seeded, possibly read-only Go module cache to generate with (env OSDK_MOD_CACHE)")
+	flag.BoolVar(&offline, "offline", os.Getenv("OSDK_OFFLINE") == "true", "Never download modules: run the go tool with GOPROXY=off (env OSDK_OFFLINE=true)")
+	seedModCache := flag.String("seed-mod-cache", "", "Download the modules generated projects need into this directory and exit")
+	flag.Parse()
+
+	if *seedModCache != "" {
+		log.Printf("Seeding the Go module cache in %s", *seedModCache)
+		if err := warmUp(generator.Generator{ModCache: *seedModCache}); err != nil {
+			log.Fatalf("Seeding failed: %v", err)
+		}
+		log.Printf("Module cache seeded in %s", *seedModCache)
+		return
 	}
-	return strings.Join(parts, "")
-}
-
-// UpdateControllerRBAC adds RBAC markers to controller files based on user selections
-func UpdateControllerRBAC(projectDir string, crds []CRD) error {
-	needsMultiGroup := hasMultipleGroups(crds)
-	log.Printf("UpdateControllerRBAC: needsMultiGroup=%v", needsMultiGroup)
 
-	for _, crd := range crds {
-		if !crd.Controller {
-			continue // Skip if no controller requested
+	if *requestFile != "" {
+		if *outputDir == "" {
+			log.Fatal("-output is required when -request is set")
 		}
-
-		var controllerDir string
-		if needsMultiGroup {
-			// Multi-group layout: internal/controller/<group>/
-			controllerDir = filepath.Join(projectDir, "internal", "controller", crd.Group)
-		} else {
-			// Single-group layout: internal/controller/
-			controllerDir = filepath.Join(projectDir, "internal", "controller")
+		if err := runOnce(*requestFile, *outputDir); err != nil {
+			log.Fatalf("Generation failed: %v", err)
 		}
+		log.Printf("Project generated in %s", *outputDir)
+		return
+	}
 
-		controllerFile := filepath.Join(controllerDir, strings.ToLower(crd.Kind)+"_controller.go")
-		log.Printf("UpdateControllerRBAC: Processing controller file: %s", controllerFile)
-
-		if _, err := os.Stat(controllerFile); os.IsNotExist(err) {
-			log.Printf("Controller file does not exist, skipping: %s", controllerFile)
-			continue
-		}
-
-		fset := token.NewFileSet()
-		file, err := decorator.ParseFile(fset, controllerFile, nil, parser.ParseComments)
-		if err != nil {
-			return fmt.Errorf("parse controller file %s: %w", controllerFile, err)
-		}
-
-		// Generate RBAC markers based on user selections
-		rbacMarkers := generateRBACMarkers(crd.RBAC, crd.Group)
-
-		if len(rbacMarkers) == 0 {
-			continue // No RBAC permissions selected
-		}
-
-		// Find the Reconcile function and add RBAC markers above it
-		dstutil.Apply(file, func(c *dstutil.Cursor) bool {
-			fn, ok := c.Node().(*dst.FuncDecl)
-			if !ok || fn.Name.Name != "Reconcile" {
-				return true
-			}
-
-			// Add RBAC markers before the Reconcile function
-			fn.Decs.Start.Append(rbacMarkers...)
-			log.Printf("Added %d RBAC markers to Reconcile function in %s", len(rbacMarkers), controllerFile)
-			return false
-		}, nil)
-
-		// Write the updated file
-		var buf bytes.Buffer
-		if err := decorator.Fprint(&buf, file); err != nil {
-			return fmt.Errorf("print controller file %s: %w", controllerFile, err)
-		}
-		if err := os.WriteFile(controllerFile, buf.Bytes(), 0o644); err != nil {
-			return fmt.Errorf("write controller file %s: %w", controllerFile, err)
+	r := gin.Default()
+	r.POST("/v1/run", runOperatorSDK)
+	r.POST("/v1/preview", previewOperatorSDK)
+	r.GET("/v1/logs", streamLogs)
+	r.GET("/healthz", healthz)
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		<-served
+		log.Println("Shutting down the container...")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
 		}
-		log.Printf("Updated controller file with RBAC markers: %s", controllerFile)
-	}
-	return nil
-}
+	}()
 
-// generateRBACMarkers creates kubebuilder RBAC markers based on user selections
-func generateRBACMarkers(rbac []RBACPermission, crdGroup string) []string {
-	var markers []string
-
-	// Always add permissions for the CRD itself
-	markers = append(markers, fmt.Sprintf("// +kubebuilder:rbac:groups=%s,resources=%ss,verbs=get;list;watch;create;update;patch;delete", crdGroup, strings.ToLower(crdGroup)))
-	markers = append(markers, fmt.Sprintf("// +kubebuilder:rbac:groups=%s,resources=%ss/status,verbs=get;update;patch", crdGroup, strings.ToLower(crdGroup)))
-	markers = append(markers, fmt.Sprintf("// +kubebuilder:rbac:groups=%s,resources=%ss/finalizers,verbs=update", crdGroup, strings.ToLower(crdGroup)))
-
-	// Add user-defined RBAC permissions
-	for _, permission := range rbac {
-		if permission.Group != "" || permission.Resources != "" || permission.Verbs != "" {
-			group := permission.Group
-			if group == "" {
-				group = `""`
+	if poolMode && cacheDir != "" {
+		go func() {
+			log.Printf("Warming up the Go caches in %s", cacheDir)
+			if err := warmUp(newGenerator()); err != nil {
+				log.Printf("Warning: warm-up failed, requests will download what they need: %v", err)
 			}
-			markers = append(markers, fmt.Sprintf("// +kubebuilder:rbac:groups=%s,resources=%s,verbs=%s", group, permission.Resources, permission.Verbs))
-		}
+			warm.Store(true)
+		}()
+	} else {
+		warm.Store(true)
 	}
 
-	return markers
-}
-
-func main() {
-	r := gin.Default()
-	r.POST("/v1/run", runOperatorSDK)
 	log.Println("Starting server on :8080...")
-	r.Run(":8080")
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("Server failed: %v", err)
+	}
 }